@@ -8,6 +8,7 @@ const (
 	AllowedTypeKeyword AllowedType = iota
 	AllowedTypePath
 	AllowedTypeURL
+	AllowedTypeSegment
 )
 
 var allowedRe = map[AllowedType]string{
@@ -17,12 +18,16 @@ var allowedRe = map[AllowedType]string{
 	AllowedTypePath: `^(?:(?:(?:[A-Za-z]:[\\/])|(?:\\\\)|/|\./|\.\./).+)?$`,
 	// URL matches common scheme URLs like https://, s3://, file://, etc.
 	AllowedTypeURL: `^(?:[A-Za-z][A-Za-z0-9+.-]*://\S+)?$`,
+	// Segment is a single path segment safe to join into paths and keys,
+	// without "_" which separates toolchain components.
+	AllowedTypeSegment: `^[A-Za-z0-9][A-Za-z0-9.+-]*$`,
 }
 
 var allowedReCompiled = map[AllowedType]*regexp.Regexp{
 	AllowedTypeKeyword: regexp.MustCompile(allowedRe[AllowedTypeKeyword]),
 	AllowedTypePath:    regexp.MustCompile(allowedRe[AllowedTypePath]),
 	AllowedTypeURL:     regexp.MustCompile(allowedRe[AllowedTypeURL]),
+	AllowedTypeSegment: regexp.MustCompile(allowedRe[AllowedTypeSegment]),
 }
 
 type Allowed struct{}
@@ -53,6 +58,10 @@ func (a *Allowed) IsURL(s string) bool {
 	return a.Match(AllowedTypeURL, s)
 }
 
+func (a *Allowed) IsSegment(s string) bool {
+	return a.Match(AllowedTypeSegment, s)
+}
+
 // Detect returns the first matched AllowedType in the order: URL -> Path -> Keyword.
 func (a *Allowed) Detect(s string) (AllowedType, bool) {
 	if a.Match(AllowedTypeURL, s) {
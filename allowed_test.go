@@ -53,4 +53,10 @@ func TestAllowed_IsHelpers(t *testing.T) {
 	if !a.IsURL("") {
 		t.Fatalf("IsURL(\"\") should be true")
 	}
+	if !a.IsSegment("ubuntu22.04") {
+		t.Fatalf("IsSegment should accept letters/digits/dots")
+	}
+	if a.IsSegment("..") || a.IsSegment("a/b") || a.IsSegment("a_b") || a.IsSegment("") {
+		t.Fatalf("IsSegment should reject dot-dot, separators and empty")
+	}
 }
@@ -1,6 +1,11 @@
 package dynamic
 
-import "log"
+import (
+	"context"
+	"crypto/ed25519"
+	"log"
+	"time"
+)
 
 // UseWarehouse:
 //
@@ -61,6 +66,8 @@ func UseDefaultVersion(version string) {
 	packageCenter.UseDefaultVersion(version)
 }
 
+// RegisterPackage registers a tunnel and initializes it, a tunnel whose Init
+// fails or panics is logged and not registered, see TryRegisterPackage.
 func RegisterPackage(pkg string, version string, tunnel Tunnel) {
 	if !allowed.IsKeyword(pkg) {
 		panic("dynamic: invalid package name")
@@ -71,6 +78,28 @@ func RegisterPackage(pkg string, version string, tunnel Tunnel) {
 	packageCenter.RegisterPackage(pkg, version, tunnel)
 }
 
+// TryRegisterPackage is RegisterPackage returning the error of Init, a
+// panic in it is returned as a *PanicError.
+func TryRegisterPackage(pkg string, version string, tunnel Tunnel) error {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	return packageCenter.TryRegisterPackage(pkg, version, tunnel)
+}
+
+// RegisterPackageV2 is the TunnelV2 form of RegisterPackage.
+func RegisterPackageV2(pkg string, version string, tunnel TunnelV2) {
+	RegisterPackage(pkg, version, AsTunnel(tunnel))
+}
+
+// TryRegisterPackageV2 is the TunnelV2 form of TryRegisterPackage.
+func TryRegisterPackageV2(pkg string, version string, tunnel TunnelV2) error {
+	return TryRegisterPackage(pkg, version, AsTunnel(tunnel))
+}
+
 func GetPackage(pkg string, version string) (Tunnel, error) {
 	if !allowed.IsKeyword(pkg) {
 		panic("dynamic: invalid package name")
@@ -85,6 +114,15 @@ func GetPackage(pkg string, version string) (Tunnel, error) {
 	return tunnel, nil
 }
 
+// GetPackageV2 is the TunnelV2 form of GetPackage, v1 packages are adapted.
+func GetPackageV2(pkg string, version string) (TunnelV2, error) {
+	tunnel, err := GetPackage(pkg, version)
+	if err != nil {
+		return nil, err
+	}
+	return AsTunnelV2(tunnel), nil
+}
+
 func ClosePackage(pkg string, version string) {
 	if !allowed.IsKeyword(pkg) {
 		panic("dynamic: invalid package name")
@@ -94,3 +132,273 @@ func ClosePackage(pkg string, version string) {
 	}
 	packageCenter.ClosePackage(pkg, version)
 }
+
+// Prefetch syncs the packages from the remote in parallel, and opens and
+// initializes those with Load set, so that the first GetPackage doesn't pay
+// for it. It returns every failure, or the error of ctx if done first, which
+// also stops the downloads. A package synced meanwhile by another caller is
+// downloaded once.
+func Prefetch(ctx context.Context, refs []PackageRef) error {
+	for _, ref := range refs {
+		if !allowed.IsKeyword(ref.Package) {
+			panic("dynamic: invalid package name")
+		}
+		if !allowed.IsKeyword(ref.Version) {
+			panic("dynamic: invalid package version")
+		}
+	}
+	return prefetch(ctx, refs)
+}
+
+// UsePrefetch prefetches the packages in the background at startup, Ready
+// and WaitReady report when it is done.
+func UsePrefetch(refs ...PackageRef) {
+	for _, ref := range refs {
+		if !allowed.IsKeyword(ref.Package) {
+			panic("dynamic: invalid package name")
+		}
+		if !allowed.IsKeyword(ref.Version) {
+			panic("dynamic: invalid package version")
+		}
+	}
+	readiness.Start(refs)
+}
+
+// Ready tells whether every package passed to UsePrefetch is prefetched,
+// e.g. for a readiness probe.
+func Ready() bool {
+	return readiness.Ready()
+}
+
+// WaitReady waits for the packages passed to UsePrefetch and returns the
+// failures of their prefetch.
+func WaitReady(ctx context.Context) error {
+	return readiness.Wait(ctx)
+}
+
+// Describe lists the methods accepted by the package's tunnel.
+func Describe(pkg string, version string) ([]MethodDescriptor, error) {
+	tunnel, err := GetPackage(pkg, version)
+	if err != nil {
+		return nil, err
+	}
+	return DescribeTunnel(tunnel)
+}
+
+// UseInterceptor wraps every tunnel returned by GetPackage with interceptors,
+// the first one outermost, e.g.:
+//
+//	dynamic.UseInterceptor(
+//		dynamic.RecoverInterceptor(),
+//		dynamic.SlowCallInterceptor(time.Second),
+//		dynamic.TimeoutInterceptor(5*time.Second, nil),
+//	)
+func UseInterceptor(interceptors ...Interceptor) {
+	packageCenter.UseInterceptor(interceptors...)
+}
+
+// UseQuarantine stops a package whose tunnel panicked from being loaded
+// again for d, so a broken plugin isn't retried in a hot loop.
+func UseQuarantine(d time.Duration) {
+	tunnelCenter.UseQuarantine(d)
+}
+
+// PackageFault returns the last panic recovered from the package's tunnel.
+func PackageFault(pkg string, version string) (Fault, bool) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	return packageCenter.Fault(pkg, version)
+}
+
+// ResetPackageFault clears the package's fault and lifts its quarantine.
+func ResetPackageFault(pkg string, version string) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	packageCenter.ResetFault(pkg, version)
+}
+
+// UsePackageMode loads every version of pkg in mode, PackageModePlugin by default.
+func UsePackageMode(pkg string, mode PackageMode) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	warehouse.UseMode(pkg, mode)
+}
+
+// UseProcessOptions configures how packages in PackageModeProcess are started.
+func UseProcessOptions(opts ProcessOptions) {
+	if err := opts.Validate(); err != nil {
+		log.Printf("[dynamic] %v", err)
+		panic("dynamic: invalid process options")
+	}
+	warehouse.UseProcessOptions(opts)
+}
+
+// UseDownloadOptions configures how packages are downloaded from the remote.
+func UseDownloadOptions(opts DownloadOptions) {
+	warehouse.UseDownloadOptions(opts)
+}
+
+// UseArchiveKeys only accepts package archives whose manifest is signed by
+// one of keys, and which hold nothing else than the files it lists with
+// their checksums. Packages published as loose files are not signed.
+func UseArchiveKeys(keys ...ed25519.PublicKey) {
+	warehouse.UseArchiveKeys(keys...)
+}
+
+// Downloads returns the progress of the file downloads in flight,
+// e.g. for a health endpoint to report slow starts.
+func Downloads() []DownloadProgress {
+	return warehouse.Downloads()
+}
+
+// UseNegativeCache remembers for ttl the packages the remote doesn't have
+// for the current toolchain, refusing to load them meanwhile without
+// asking it again. Zero disables it.
+func UseNegativeCache(ttl time.Duration) {
+	warehouse.missing.UseTTL(ttl)
+}
+
+// InvalidateNegativeCache forgets that the package was missing, e.g. once
+// it is published.
+func InvalidateNegativeCache(pkg string, version string) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	warehouse.missing.Forget(packageCenter.IndexName(pkg, version))
+}
+
+// ResetNegativeCache forgets every missing package.
+func ResetNegativeCache() {
+	warehouse.missing.Reset()
+}
+
+// NegativeCacheStats returns the counters of the negative cache.
+func NegativeCacheStats() CacheStats {
+	return warehouse.missing.Stats()
+}
+
+// ProcessRestarts returns how many times the package's child process was
+// restarted, false if the package isn't loaded in PackageModeProcess.
+func ProcessRestarts(pkg string, version string) (int, bool) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	tunnel, ok := packageCenter.LookupTunnel(pkg, version)
+	if !ok {
+		return 0, false
+	}
+	p, ok := findTunnel[*ProcessTunnel](tunnel)
+	if !ok {
+		return 0, false
+	}
+	return p.Restarts(), true
+}
+
+// UseToolchain loads packages built for info instead of the detected or
+// injected toolchain.
+func UseToolchain(info ToolchainInfo) {
+	if err := toolchain.Use(info); err != nil {
+		log.Printf("[dynamic] %v", err)
+		panic("dynamic: invalid toolchain")
+	}
+	if warehouse.Local != nil {
+		warehouse.Local.ResetMatched()
+	}
+}
+
+// CurrentToolchain returns the toolchain packages are loaded for, e.g. for
+// CI to emit it as JSON and build plugins targeting it.
+func CurrentToolchain() ToolchainInfo {
+	return toolchain.Info()
+}
+
+// DescribeToolchain renders the full toolchain descriptor of the host,
+// packages must be built for it, e.g. with the same tags and cgo setting.
+func DescribeToolchain() string {
+	return toolchain.Describe()
+}
+
+// UseOSAlias lets packages built for any of aliases be loaded on a host
+// whose OS descriptor is osDesc, e.g. UseOSAlias("ubuntu22.04", "debian12").
+func UseOSAlias(osDesc string, aliases ...string) {
+	toolchain.UseOSAlias(osDesc, aliases...)
+}
+
+// UseToolchainEquivalent lets packages built for the equivalent toolchain
+// directories be loaded on a host whose toolchain is t.
+func UseToolchainEquivalent(t string, equivalents ...string) {
+	toolchain.UseEquivalent(t, equivalents...)
+}
+
+// UseLibcRule accepts packages built against an older libc, e.g.
+// UseLibcRule("glibc >= 2.31") on a glibc 2.36 host probes glibc2.36 down
+// to glibc2.31 as OS descriptors.
+func UseLibcRule(rule string) {
+	r, err := ParseLibcRule(rule)
+	if err != nil {
+		log.Printf("[dynamic] %v", err)
+		panic("dynamic: invalid libc rule")
+	}
+	toolchain.UseLibcRule(r)
+}
+
+// MatchedToolchain returns the toolchain directory the package was found in.
+func MatchedToolchain(pkg string, version string) (string, bool) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	if warehouse.Local == nil {
+		return "", false
+	}
+	return warehouse.Local.Matched(packageCenter.IndexName(pkg, version))
+}
+
+// PackageAssetDir returns the asset directory of the package, for tunnels
+// whose Init has no context to read it from with AssetDir.
+func PackageAssetDir(pkg string, version string) (string, bool) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	return warehouse.AssetDir(packageCenter.IndexName(pkg, version))
+}
+
+// Check reports the differences between the build of the package's plugin
+// and the host without opening it, the Fatal ones make plugin.Open fail.
+func Check(pkg string, version string) (*CheckReport, error) {
+	if !allowed.IsKeyword(pkg) {
+		panic("dynamic: invalid package name")
+	}
+	if !allowed.IsKeyword(version) {
+		panic("dynamic: invalid package version")
+	}
+	return warehouse.Check(packageCenter.IndexName(pkg, version))
+}
+
+// RegisterCodec makes codec available to Call and Dispatcher under codec.Name().
+func RegisterCodec(codec Codec) {
+	if !allowed.IsKeyword(codec.Name()) {
+		panic("dynamic: invalid codec name")
+	}
+	codecCenter.RegisterCodec(codec)
+}
@@ -0,0 +1,160 @@
+package dynamic
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveSuffix is the suffix of a package archive, <name>.tar.zst next to
+// the package directory, holding the manifest, the artifacts, the assets
+// and the signature of the package as one object. The artifacts are
+// verified against the manifest once unpacked, and the manifest against
+// its signature when archive keys are in use, see UseArchiveKeys.
+const ArchiveSuffix = ".tar.zst"
+
+// SignatureFileName is the ed25519 signature of the manifest in a package
+// archive, see SignManifest.
+const SignatureFileName = "manifest.sig"
+
+// SignManifest returns the signature of the manifest data of an archive,
+// to be stored in it as SignatureFileName.
+func SignManifest(key ed25519.PrivateKey, manifest []byte) []byte {
+	return ed25519.Sign(key, manifest)
+}
+
+// verifySignature checks that the manifest in dir is signed by one of keys,
+// and that it covers every file of dir by their checksums.
+func verifySignature(dir string, keys []ed25519.PublicKey) error {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return fmt.Errorf("dynamic: unsigned archive, %w", err)
+	}
+	sig, err := os.ReadFile(filepath.Join(dir, SignatureFileName))
+	if err != nil {
+		return fmt.Errorf("dynamic: unsigned archive, %w", err)
+	}
+	signed := false
+	for _, key := range keys {
+		if ed25519.Verify(key, data, sig) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return errors.New("dynamic: invalid archive signature")
+	}
+
+	m, err := ParseManifest(data)
+	if err != nil {
+		return err
+	}
+	covered := map[string]bool{ManifestFileName: true, SignatureFileName: true}
+	for _, a := range m.Artifacts {
+		if a.SHA256 == "" {
+			return fmt.Errorf("dynamic: signed artifact %s has no sha256", a.File)
+		}
+		covered[filepath.Clean(a.File)] = true
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !covered[rel] {
+			return fmt.Errorf("dynamic: archive file %s is not in the signed manifest", filepath.ToSlash(rel))
+		}
+		return nil
+	})
+}
+
+// ArchivePath returns the local path of the archive of a package under
+// toolchainDir, while it is downloaded.
+func (l Local) ArchivePath(toolchainDir string, name string) string {
+	return l.DirOf(toolchainDir, name) + ArchiveSuffix
+}
+
+// UnpackArchive unpacks the archive of a package at path into its
+// directory under toolchainDir. The archive is unpacked and verified aside
+// and then replaces the directory as a whole, never leaving a partial
+// package behind. With keys, its manifest must be signed by one of them.
+func (l Local) UnpackArchive(toolchainDir string, name string, mode PackageMode, path string, keys ...ed25519.PublicKey) error {
+	dir := l.DirOf(toolchainDir, name)
+	tempDir := dir + ".unpack"
+	if err := os.RemoveAll(tempDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := unpackArchive(path, tempDir); err != nil {
+		return fmt.Errorf("failed to unpack archive %s, %w", path, err)
+	}
+	if len(keys) > 0 {
+		if err := verifySignature(tempDir, keys); err != nil {
+			return err
+		}
+	}
+
+	m, err := ReadManifest(tempDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		m = DefaultManifest(name, mode)
+	}
+	for _, a := range m.Artifacts {
+		artifactPath := filepath.Join(tempDir, a.File)
+		if _, err := os.Stat(artifactPath); err != nil && a.Optional && os.IsNotExist(err) {
+			continue
+		}
+		if err := a.Verify(artifactPath); err != nil {
+			return err
+		}
+		if a.Kind == ArtifactAssets {
+			if err := unpackAssets(artifactPath, tempDir); err != nil {
+				return err
+			}
+		}
+	}
+
+	oldDir := dir + ".old"
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, oldDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tempDir, dir); err != nil {
+		os.Rename(oldDir, dir)
+		return err
+	}
+	os.RemoveAll(oldDir)
+
+	log.Printf("[dynamic] unpacked warehouse package %s archive: %s", name, path)
+	return nil
+}
+
+func unpackArchive(path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	return untar(zr, dir)
+}
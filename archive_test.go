@@ -0,0 +1,130 @@
+package dynamic_test
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aura-studio/dynamic"
+	"github.com/klauspost/compress/zstd"
+)
+
+func writeArchive(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpackArchive(t *testing.T) {
+	local := dynamic.NewLocal(t.TempDir())
+	path := filepath.Join(t.TempDir(), "foo"+dynamic.ArchiveSuffix)
+
+	sum := sha256.Sum256([]byte("plugin"))
+	manifest := fmt.Sprintf(`{"name":"foo","artifacts":[{"file":"libgo_foo.so","kind":"go","sha256":%q},{"file":"assets/a.txt","kind":"data"}]}`, hex.EncodeToString(sum[:]))
+	writeArchive(t, path, map[string]string{
+		dynamic.ManifestFileName: manifest,
+		"libgo_foo.so":           "plugin",
+		"assets/a.txt":           "asset",
+	})
+	if err := local.UnpackArchive("tc", "foo", dynamic.PackageModePlugin, path); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(local.DirOf("tc", "foo"), "assets", "a.txt")); err != nil || string(b) != "asset" {
+		t.Fatalf("asset %q, %v", b, err)
+	}
+
+	// a corrupted archive leaves the unpacked package untouched.
+	writeArchive(t, path, map[string]string{
+		dynamic.ManifestFileName: manifest,
+		"libgo_foo.so":           "corrupted",
+		"assets/a.txt":           "asset",
+	})
+	if err := local.UnpackArchive("tc", "foo", dynamic.PackageModePlugin, path); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if b, err := os.ReadFile(filepath.Join(local.DirOf("tc", "foo"), "libgo_foo.so")); err != nil || string(b) != "plugin" {
+		t.Fatalf("plugin %q, %v", b, err)
+	}
+}
+
+func TestUnpackArchive_Signed(t *testing.T) {
+	local := dynamic.NewLocal(t.TempDir())
+	path := filepath.Join(t.TempDir(), "foo"+dynamic.ArchiveSuffix)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, otherPrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("plugin"))
+	manifest := fmt.Sprintf(`{"name":"foo","artifacts":[{"file":"libgo_foo.so","kind":"go","sha256":%q}]}`, hex.EncodeToString(sum[:]))
+	unhashed := `{"name":"foo","artifacts":[{"file":"libgo_foo.so","kind":"go"}]}`
+	signed := func(manifest string, key ed25519.PrivateKey, extra map[string]string) map[string]string {
+		files := map[string]string{
+			dynamic.ManifestFileName:  manifest,
+			dynamic.SignatureFileName: string(dynamic.SignManifest(key, []byte(manifest))),
+			"libgo_foo.so":            "plugin",
+		}
+		for name, content := range extra {
+			files[name] = content
+		}
+		return files
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		ok    bool
+	}{
+		{"signed", signed(manifest, private, nil), true},
+		{"other key", signed(manifest, otherPrivate, nil), false},
+		{"unsigned", map[string]string{dynamic.ManifestFileName: manifest, "libgo_foo.so": "plugin"}, false},
+		{"without sha256", signed(unhashed, private, nil), false},
+		{"unlisted file", signed(manifest, private, map[string]string{"libcgo_foo.so": "injected"}), false},
+	}
+	for _, tt := range tests {
+		writeArchive(t, path, tt.files)
+		err := local.UnpackArchive("tc", "foo", dynamic.PackageModePlugin, path, public)
+		if tt.ok != (err == nil) {
+			t.Errorf("UnpackArchive %s err=%v want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+
+	// any of the keys in use may sign.
+	writeArchive(t, path, signed(manifest, otherPrivate, nil))
+	if err := local.UnpackArchive("tc", "foo", dynamic.PackageModePlugin, path, public, otherPublic); err != nil {
+		t.Fatalf("UnpackArchive signed by the second key err=%v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package dynamic
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AssetsDirName is the directory of a package holding its data assets,
+// shipped as data artifacts under it or as an assets archive unpacked to it.
+const AssetsDirName = "assets"
+
+// EnvAssetDir passes the asset directory of a process package to the child,
+// Serve puts it in the context of Init.
+const EnvAssetDir = "DYNAMIC_ASSET_DIR"
+
+type assetDirKey struct{}
+
+// WithAssetDir returns a copy of ctx carrying the asset directory of a package.
+func WithAssetDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, assetDirKey{}, dir)
+}
+
+// AssetDir returns the asset directory of the package a tunnel is loaded
+// from, from the context passed to its Init.
+func AssetDir(ctx context.Context) (string, bool) {
+	dir, ok := ctx.Value(assetDirKey{}).(string)
+	return dir, ok && dir != ""
+}
+
+// unpackAssets extracts the assets archive at path, a .tar or .tar.gz, into
+// the assets directory of the package in dir, replacing it as a whole.
+func unpackAssets(path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read assets %s, %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	assetsDir := filepath.Join(dir, AssetsDirName)
+	tempDir := assetsDir + ".unpack"
+	if err := os.RemoveAll(tempDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := untar(r, tempDir); err != nil {
+		return fmt.Errorf("failed to unpack assets %s, %w", path, err)
+	}
+	if err := os.RemoveAll(assetsDir); err != nil {
+		return err
+	}
+	return os.Rename(tempDir, assetsDir)
+}
+
+// untar extracts the directories and regular files of a tar stream into
+// dir, refusing entries escaping it.
+func untar(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "" || name == "." {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("dynamic: invalid archive entry %q", hdr.Name)
+		}
+		path := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm()|0600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("dynamic: unsupported archive entry %q", hdr.Name)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package dynamic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var ErrMethodNotFound = errors.New("dynamic: method not found")
+
+// Call invokes method on t with a typed request and decodes the typed response,
+// using the codec the tunnel advertises in its Meta.
+func Call[Req, Resp any](t Tunnel, method string, req Req) (Resp, error) {
+	return CallContext[Req, Resp](context.Background(), t, method, req)
+}
+
+func CallContext[Req, Resp any](ctx context.Context, t Tunnel, method string, req Req) (Resp, error) {
+	var resp Resp
+
+	codec, err := codecCenter.GetCodec(ParseTunnelMeta(t.Meta()).Codec)
+	if err != nil {
+		return resp, err
+	}
+
+	payload, err := codec.Marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("dynamic: marshal %s request, %w", method, err)
+	}
+
+	if err := ValidateMethod(t, method); err != nil {
+		return resp, err
+	}
+
+	out, err := AsTunnelV2(t).Invoke(ctx, method, payload)
+	if err != nil {
+		return resp, err
+	}
+
+	if len(out) == 0 {
+		return resp, nil
+	}
+	if err := codec.Unmarshal(out, &resp); err != nil {
+		return resp, fmt.Errorf("dynamic: unmarshal %s response, %w", method, err)
+	}
+
+	return resp, nil
+}
+
+type handlerFunc func(ctx context.Context, codec Codec, payload []byte) ([]byte, error)
+
+type handler struct {
+	fn         handlerFunc
+	descriptor MethodDescriptor
+}
+
+// Dispatcher is a TunnelV2 that routes method names to typed handlers.
+// The zero value is ready to use with the JSON codec, so a plugin can export
+//
+//	var Tunnel dynamic.Dispatcher
+//
+// and register its handlers with Handle in init.
+type Dispatcher struct {
+	codec    string
+	mu       sync.RWMutex
+	handlers map[string]*handler
+	methods  []string
+}
+
+func NewDispatcher(codec string) *Dispatcher {
+	return &Dispatcher{
+		codec: codec,
+	}
+}
+
+func (d *Dispatcher) UseCodec(codec string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.codec = codec
+}
+
+// Handle registers h as the handler of method on d, an optional description
+// is reported by Methods along with the request and response schemas.
+func Handle[Req, Resp any](d *Dispatcher, method string, h func(context.Context, Req) (Resp, error), description ...string) {
+	descriptor := MethodDescriptor{
+		Name:        method,
+		Description: strings.Join(description, " "),
+		Request:     typeSchema(reflect.TypeFor[Req]()),
+		Response:    typeSchema(reflect.TypeFor[Resp]()),
+	}
+	d.handle(descriptor, func(ctx context.Context, codec Codec, payload []byte) ([]byte, error) {
+		var req Req
+		if len(payload) > 0 {
+			if err := codec.Unmarshal(payload, &req); err != nil {
+				return nil, fmt.Errorf("dynamic: unmarshal %s request, %w", method, err)
+			}
+		}
+		resp, err := h(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(resp)
+	})
+}
+
+func (d *Dispatcher) handle(descriptor MethodDescriptor, fn handlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handlers == nil {
+		d.handlers = make(map[string]*handler)
+	}
+	if _, ok := d.handlers[descriptor.Name]; !ok {
+		d.methods = append(d.methods, descriptor.Name)
+	}
+	d.handlers[descriptor.Name] = &handler{
+		fn:         fn,
+		descriptor: descriptor,
+	}
+}
+
+// Methods lists the registered methods in registration order.
+func (d *Dispatcher) Methods() []MethodDescriptor {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	methods := make([]MethodDescriptor, 0, len(d.methods))
+	for _, name := range d.methods {
+		methods = append(methods, d.handlers[name].descriptor)
+	}
+	return methods
+}
+
+func (d *Dispatcher) Meta() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return TunnelMeta{Codec: d.codec}.String()
+}
+
+func (d *Dispatcher) Init(ctx context.Context) error {
+	return nil
+}
+
+func (d *Dispatcher) Invoke(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	d.mu.RLock()
+	h, ok := d.handlers[method]
+	codecName := d.codec
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMethodNotFound, method)
+	}
+
+	codec, err := codecCenter.GetCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.fn(ctx, codec, payload)
+}
+
+func (d *Dispatcher) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package dynamic_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+type addReq struct {
+	A, B int
+}
+
+type addResp struct {
+	Sum int
+}
+
+func TestCall_Dispatcher(t *testing.T) {
+	for _, codec := range []string{"", dynamic.CodecJSON, dynamic.CodecGob, dynamic.CodecMsgpack} {
+		d := dynamic.NewDispatcher(codec)
+		dynamic.Handle(d, "add", func(ctx context.Context, req addReq) (addResp, error) {
+			return addResp{Sum: req.A + req.B}, nil
+		})
+		tunnel := dynamic.AsTunnel(d)
+
+		resp, err := dynamic.Call[addReq, addResp](tunnel, "add", addReq{A: 1, B: 2})
+		if err != nil {
+			t.Fatalf("codec %q: Call err=%v", codec, err)
+		}
+		if resp.Sum != 3 {
+			t.Fatalf("codec %q: Sum=%d want 3", codec, resp.Sum)
+		}
+
+		if _, err := dynamic.Call[addReq, addResp](tunnel, "sub", addReq{}); !errors.Is(err, dynamic.ErrMethodNotFound) {
+			t.Fatalf("codec %q: unknown method err=%v want ErrMethodNotFound", codec, err)
+		}
+	}
+}
+
+func TestDescribeTunnel_Dispatcher(t *testing.T) {
+	d := dynamic.NewDispatcher(dynamic.CodecJSON)
+	dynamic.Handle(d, "add", func(ctx context.Context, req addReq) (addResp, error) {
+		return addResp{}, nil
+	}, "adds two integers")
+
+	methods, err := dynamic.DescribeTunnel(dynamic.AsTunnel(d))
+	if err != nil {
+		t.Fatalf("DescribeTunnel err=%v", err)
+	}
+	if len(methods) != 1 || methods[0].Name != "add" || methods[0].Description != "adds two integers" {
+		t.Fatalf("DescribeTunnel=%+v", methods)
+	}
+	if want := `{"properties":{"A":{"type":"integer"},"B":{"type":"integer"}},"type":"object"}`; string(methods[0].Request) != want {
+		t.Fatalf("Request schema=%s want %s", methods[0].Request, want)
+	}
+
+	if _, err := dynamic.DescribeTunnel(&echoTunnel{}); !errors.Is(err, dynamic.ErrMethodsNotDescribed) {
+		t.Fatalf("DescribeTunnel on plain tunnel err=%v want ErrMethodsNotDescribed", err)
+	}
+}
+
+func TestDispatcher_UseCodecConcurrently(t *testing.T) {
+	d := dynamic.NewDispatcher(dynamic.CodecJSON)
+	dynamic.Handle(d, "add", func(ctx context.Context, req addReq) (addResp, error) {
+		return addResp{Sum: req.A + req.B}, nil
+	})
+	tunnel := dynamic.AsTunnel(d)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			d.UseCodec(dynamic.CodecMsgpack)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		tunnel.Meta()
+	}
+	<-done
+
+	resp, err := dynamic.Call[addReq, addResp](tunnel, "add", addReq{A: 2, B: 3})
+	if err != nil || resp.Sum != 5 {
+		t.Fatalf("msgpack Call=%v,%v want 5,nil", resp.Sum, err)
+	}
+}
+
+type schemaBase struct {
+	ID   int    `json:"id"`
+	Note string `json:"note"`
+}
+
+type schemaReq struct {
+	schemaBase
+	Note  string   `json:"note"`
+	Hash  [4]byte  `json:"hash"`
+	Bytes []byte   `json:"bytes"`
+	Meta  struct{} `json:"-"`
+}
+
+func TestDescribeTunnel_SchemaFollowsJSON(t *testing.T) {
+	d := dynamic.NewDispatcher(dynamic.CodecJSON)
+	dynamic.Handle(d, "put", func(ctx context.Context, req schemaReq) (addResp, error) {
+		return addResp{}, nil
+	})
+
+	methods, err := dynamic.DescribeTunnel(dynamic.AsTunnel(d))
+	if err != nil {
+		t.Fatalf("DescribeTunnel err=%v", err)
+	}
+	want := `{"properties":{"bytes":{"contentEncoding":"base64","type":"string"},"hash":{"items":{"type":"integer"},"type":"array"},"id":{"type":"integer"},"note":{"type":"string"}},"type":"object"}`
+	if string(methods[0].Request) != want {
+		t.Fatalf("Request schema=%s want %s", methods[0].Request, want)
+	}
+}
@@ -0,0 +1,201 @@
+package dynamic
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	MismatchGo      = "go"
+	MismatchModule  = "module"
+	MismatchSetting = "setting"
+)
+
+// pluginBuildSettings are the build settings that must agree between a host and
+// its plugins.
+var pluginBuildSettings = []string{
+	"-compiler",
+	"-tags",
+	"-trimpath",
+	"-race",
+	"-msan",
+	"-asan",
+	"CGO_ENABLED",
+	"GOOS",
+	"GOARCH",
+	"GOAMD64",
+	"GOARM",
+	"GOARM64",
+	"GO386",
+}
+
+// Mismatch is one difference between the host and a plugin build.
+// An empty Host or Plugin means it is missing on that side.
+type Mismatch struct {
+	Kind   string
+	Name   string
+	Host   string
+	Plugin string
+}
+
+// CheckReport is the result of comparing a plugin's embedded build info
+// with the host's.
+type CheckReport struct {
+	Path       string
+	Mismatches []Mismatch
+}
+
+// Fatal tells whether plugin.Open rejects a plugin over the mismatch, as
+// it does for a different Go version or shared module version. Build
+// settings only change the packages they affect, the runtime may accept
+// them.
+func (m Mismatch) Fatal() bool {
+	return m.Kind == MismatchGo || m.Kind == MismatchModule
+}
+
+func (r *CheckReport) Compatible() bool {
+	return len(r.Mismatches) == 0
+}
+
+// Loadable tells whether no mismatch is fatal, the plugin may still fail to
+// open over the others.
+func (r *CheckReport) Loadable() bool {
+	for _, m := range r.Mismatches {
+		if m.Fatal() {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the mismatches as a diff, host lines prefixed with "-"
+// and plugin lines with "+".
+func (r *CheckReport) String() string {
+	if r.Compatible() {
+		return fmt.Sprintf("%s: compatible with host", r.Path)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d mismatches with host", r.Path, len(r.Mismatches))
+	for _, m := range r.Mismatches {
+		fmt.Fprintf(&b, "\n  %s %s\n", m.Kind, m.Name)
+		fmt.Fprintf(&b, "    - host:   %s\n", orNone(m.Host))
+		fmt.Fprintf(&b, "    + plugin: %s", orNone(m.Plugin))
+	}
+	return b.String()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+var hostBuildInfo = sync.OnceValues(func() (*debug.BuildInfo, bool) {
+	return debug.ReadBuildInfo()
+})
+
+// CheckPlugin compares the Go version, shared module versions and build
+// settings embedded in the plugin at path with the running binary, to
+// explain in advance why plugin.Open would fail.
+func CheckPlugin(path string) (*CheckReport, error) {
+	host, ok := hostBuildInfo()
+	if !ok {
+		return nil, fmt.Errorf("dynamic: host binary has no build info")
+	}
+	plug, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("dynamic: read build info of %s, %w", path, err)
+	}
+	return compareBuildInfo(path, host, plug), nil
+}
+
+func compareBuildInfo(path string, host, plug *debug.BuildInfo) *CheckReport {
+	report := &CheckReport{Path: path}
+
+	if host.GoVersion != plug.GoVersion {
+		report.Mismatches = append(report.Mismatches, Mismatch{
+			Kind:   MismatchGo,
+			Name:   "version",
+			Host:   host.GoVersion,
+			Plugin: plug.GoVersion,
+		})
+	}
+
+	// only modules linked into both sides must agree, modules built from a
+	// working tree ("(devel)") can't be compared.
+	hostModules := modulesOf(host)
+	pluginModules := modulesOf(plug)
+	var paths []string
+	for path, version := range pluginModules {
+		hostVersion, ok := hostModules[path]
+		if !ok || isDevelModule(version) || isDevelModule(hostVersion) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if hostModules[path] != pluginModules[path] {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Kind:   MismatchModule,
+				Name:   path,
+				Host:   hostModules[path],
+				Plugin: pluginModules[path],
+			})
+		}
+	}
+
+	hostSettings := settingsOf(host)
+	pluginSettings := settingsOf(plug)
+	for _, key := range pluginBuildSettings {
+		if hostSettings[key] != pluginSettings[key] {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Kind:   MismatchSetting,
+				Name:   key,
+				Host:   hostSettings[key],
+				Plugin: pluginSettings[key],
+			})
+		}
+	}
+
+	return report
+}
+
+// modulesOf maps module paths to "version sum" after replacements,
+// the main module included.
+func modulesOf(info *debug.BuildInfo) map[string]string {
+	modules := make(map[string]string, len(info.Deps)+1)
+	add := func(m *debug.Module) {
+		if m == nil || m.Path == "" {
+			return
+		}
+		path := m.Path
+		for m.Replace != nil {
+			m = m.Replace
+		}
+		modules[path] = strings.TrimSpace(m.Version + " " + m.Sum)
+	}
+	add(&info.Main)
+	for _, m := range info.Deps {
+		add(m)
+	}
+	return modules
+}
+
+func isDevelModule(version string) bool {
+	return version == "" || strings.HasPrefix(version, "(devel)")
+}
+
+func settingsOf(info *debug.BuildInfo) map[string]string {
+	settings := make(map[string]string, len(info.Settings))
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	return settings
+}
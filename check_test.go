@@ -0,0 +1,38 @@
+package dynamic_test
+
+import (
+	"os"
+	"testing"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func TestCheckPlugin_Self(t *testing.T) {
+	report, err := dynamic.CheckPlugin(os.Args[0])
+	if err != nil {
+		t.Fatalf("CheckPlugin err=%v", err)
+	}
+	if !report.Compatible() || !report.Loadable() {
+		t.Fatalf("CheckPlugin of the host itself=%s want compatible", report)
+	}
+}
+
+func TestCheckReport_Loadable(t *testing.T) {
+	for _, tt := range []struct {
+		mismatch dynamic.Mismatch
+		loadable bool
+	}{
+		{dynamic.Mismatch{Kind: dynamic.MismatchGo, Name: "version", Host: "go1.24.0", Plugin: "go1.24.1"}, false},
+		{dynamic.Mismatch{Kind: dynamic.MismatchModule, Name: "example.com/m", Host: "v1.0.0", Plugin: "v1.1.0"}, false},
+		{dynamic.Mismatch{Kind: dynamic.MismatchSetting, Name: "-tags", Host: "", Plugin: "netgo"}, true},
+		{dynamic.Mismatch{Kind: dynamic.MismatchSetting, Name: "-trimpath", Host: "true", Plugin: ""}, true},
+	} {
+		report := &dynamic.CheckReport{Path: "plugin.so", Mismatches: []dynamic.Mismatch{tt.mismatch}}
+		if report.Compatible() {
+			t.Fatalf("%s %s: Compatible=true with a mismatch", tt.mismatch.Kind, tt.mismatch.Name)
+		}
+		if report.Loadable() != tt.loadable {
+			t.Fatalf("%s %s: Loadable=%v want %v", tt.mismatch.Kind, tt.mismatch.Name, report.Loadable(), tt.loadable)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	CodecJSON    = "json"
+	CodecGob     = "gob"
+	CodecMsgpack = "msgpack"
+)
+
+// Codec encodes typed requests and responses into Invoke payloads.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type GobCodec struct{}
+
+func (GobCodec) Name() string {
+	return CodecGob
+}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MsgpackCodec is a compact binary codec, fields are named by their
+// msgpack tag, or else their json tag, like JSONCodec.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Name() string {
+	return CodecMsgpack
+}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type CodecCenter struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+var codecCenter = NewCodecCenter()
+
+func NewCodecCenter() *CodecCenter {
+	cc := &CodecCenter{
+		codecs: make(map[string]Codec),
+	}
+	cc.RegisterCodec(JSONCodec{})
+	cc.RegisterCodec(GobCodec{})
+	cc.RegisterCodec(MsgpackCodec{})
+	return cc
+}
+
+func (cc *CodecCenter) RegisterCodec(codec Codec) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.codecs[codec.Name()] = codec
+}
+
+// GetCodec returns the named codec, an empty name selects JSON.
+func (cc *CodecCenter) GetCodec(name string) (Codec, error) {
+	if name == "" {
+		name = CodecJSON
+	}
+
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	codec, ok := cc.codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("dynamic: codec %s not registered", name)
+	}
+	return codec, nil
+}
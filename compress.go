@@ -0,0 +1,84 @@
+package dynamic
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encodings of the remote objects of artifacts, see Artifact.Encoding. A
+// compressed object is stored under the file of its artifact with the
+// suffix of its encoding, e.g. libgo_<name>.so.zst.
+const (
+	EncodingZstd = "zstd"
+	EncodingGzip = "gzip"
+)
+
+// legacyEncodings are the encodings the objects of a package without
+// manifest are looked up in, best first.
+var legacyEncodings = []string{EncodingZstd, EncodingGzip, ""}
+
+var encodingSuffixes = map[string]string{
+	EncodingZstd: ".zst",
+	EncodingGzip: ".gz",
+	"":           "",
+}
+
+// decompress returns a reader of the content of r compressed by encoding.
+func decompress(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader, %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	case EncodingGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader, %w", err)
+		}
+		return gr, nil
+	case "":
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("dynamic: unknown encoding %q", encoding)
+	}
+}
+
+// decompressVerified decompresses the file at path compressed by encoding
+// into a new file at dest, verifying the content of artifact as it is
+// written.
+func decompressVerified(artifact Artifact, encoding string, path string, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := decompress(encoding, f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create file %q, %w", dest, err)
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), r)
+	if err != nil {
+		return fmt.Errorf("failed to decompress %s, %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return artifact.verify(size, h.Sum(nil))
+}
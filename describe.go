@@ -0,0 +1,165 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var ErrMethodsNotDescribed = errors.New("dynamic: tunnel does not describe its methods")
+
+// MethodDescriptor describes a method name accepted by a tunnel's Invoke.
+// Request and Response hold JSON schemas of the payloads when known.
+type MethodDescriptor struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// Describer is optionally implemented by Tunnel and TunnelV2 to list their methods.
+type Describer interface {
+	Methods() []MethodDescriptor
+}
+
+// DescribeTunnel returns the methods of t, looking through interceptors,
+// guards and the v1/v2 adapters.
+func DescribeTunnel(t Tunnel) ([]MethodDescriptor, error) {
+	if d, ok := findTunnel[Describer](t); ok {
+		return d.Methods(), nil
+	}
+	return nil, ErrMethodsNotDescribed
+}
+
+// ValidateMethod reports ErrMethodNotFound if t describes its methods and
+// method is not one of them. Tunnels that don't describe themselves pass.
+func ValidateMethod(t Tunnel, method string) error {
+	methods, err := DescribeTunnel(t)
+	if err != nil {
+		return nil
+	}
+	for _, m := range methods {
+		if m.Name == method {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrMethodNotFound, method)
+}
+
+// typeSchema renders a minimal JSON schema of t following encoding/json rules.
+func typeSchema(t reflect.Type) json.RawMessage {
+	data, err := json.Marshal(newSchemaBuilder().build(t))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+type schemaBuilder struct {
+	visiting map[reflect.Type]bool
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		visiting: make(map[reflect.Type]bool),
+	}
+}
+
+func (b *schemaBuilder) build(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.build(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// encoding/json only encodes []byte as base64, [N]byte is an array.
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.build(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.build(t.Elem())}
+	case reflect.Struct:
+		if b.visiting[t] {
+			return map[string]any{}
+		}
+		b.visiting[t] = true
+		defer delete(b.visiting, t)
+
+		return map[string]any{"type": "object", "properties": b.properties(t)}
+	default:
+		return map[string]any{}
+	}
+}
+
+// properties returns the schemas of the fields of struct t as encoding/json
+// names them, with the fields of untagged embedded structs promoted unless
+// a shallower field has the same name or embedded structs at the same depth
+// conflict.
+func (b *schemaBuilder) properties(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tagName := ""
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName, _, _ = strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+		}
+		if f.Anonymous && tagName == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tagName != "" {
+			name = tagName
+		}
+		properties[name] = b.build(f.Type)
+	}
+
+	promoted := map[string]any{}
+	conflicts := map[string]bool{}
+	for _, et := range embedded {
+		if b.visiting[et] {
+			continue
+		}
+		b.visiting[et] = true
+		for name, schema := range b.properties(et) {
+			if _, ok := promoted[name]; ok {
+				conflicts[name] = true
+			}
+			promoted[name] = schema
+		}
+		delete(b.visiting, et)
+	}
+	for name, schema := range promoted {
+		if _, ok := properties[name]; !ok && !conflicts[name] {
+			properties[name] = schema
+		}
+	}
+	return properties
+}
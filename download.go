@@ -0,0 +1,469 @@
+package dynamic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrRemoteThrottled is returned when the remote keeps rejecting
+	// requests for their rate, it is retried until MaxAttempts.
+	ErrRemoteThrottled = errors.New("dynamic: remote throttled")
+	// ErrRemoteAuth is returned when the remote refuses the credentials, it
+	// is never retried.
+	ErrRemoteAuth = errors.New("dynamic: remote access denied")
+	// errObjectChanged is returned when an object changed while resuming its
+	// download, which must start over.
+	errObjectChanged = errors.New("dynamic: remote object changed")
+)
+
+// DownloadOptions configures how the remote downloads objects.
+type DownloadOptions struct {
+	// MaxAttempts is the number of attempts of a request failing with a
+	// transient error, 5 by default.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the jittered exponential backoff
+	// between attempts, 200ms and 10s by default.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PartSize is the size of the parts of an object downloaded in
+	// parallel, 16MiB by default. Smaller objects are downloaded at once.
+	// Compressed objects are split alike, they are decompressed once
+	// downloaded.
+	PartSize int64
+	// PartConcurrency is the number of parts of an object downloaded in
+	// parallel, 4 by default, 1 downloads objects sequentially.
+	PartConcurrency int
+	// MaxConcurrent is the number of object streams, parts included, open
+	// at once by the warehouse, unlimited by default.
+	MaxConcurrent int
+	// BytesPerSecond is the bandwidth of the warehouse downloads, unlimited
+	// by default.
+	BytesPerSecond int64
+	// Progress is called when a download starts, at most every 500ms while
+	// it progresses and when it finishes. It must not block.
+	Progress func(DownloadProgress)
+}
+
+func (o DownloadOptions) withDefaults() DownloadOptions {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = 200 * time.Millisecond
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = 10 * time.Second
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = 16 << 20
+	}
+	if o.PartConcurrency <= 0 {
+		o.PartConcurrency = 4
+	}
+	return o
+}
+
+// backoff returns the delay before the attempt following attempt, half
+// fixed and half random.
+func (o DownloadOptions) backoff(attempt int) time.Duration {
+	d := min(o.MinBackoff<<min(attempt-1, 16), o.MaxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// classifyRemoteError wraps err from the remote with ErrTunnelNotExits,
+// ErrRemoteThrottled or ErrRemoteAuth when it is one of them.
+func classifyRemoteError(err error) error {
+	var status interface{ HTTPStatusCode() int }
+	var code interface{ ErrorCode() string }
+	if errors.As(err, &code) {
+		switch code.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return fmt.Errorf("%w, %w", ErrTunnelNotExits, err)
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests":
+			return fmt.Errorf("%w, %w", ErrRemoteThrottled, err)
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken":
+			return fmt.Errorf("%w, %w", ErrRemoteAuth, err)
+		}
+	}
+	if errors.As(err, &status) {
+		switch status.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w, %w", ErrTunnelNotExits, err)
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return fmt.Errorf("%w, %w", ErrRemoteThrottled, err)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%w, %w", ErrRemoteAuth, err)
+		case http.StatusPreconditionFailed:
+			return fmt.Errorf("%w, %w", errObjectChanged, err)
+		}
+	}
+	return err
+}
+
+// isInvalidRange tells whether a ranged request failed because the range
+// is outside of the object.
+func isInvalidRange(err error) bool {
+	var status interface{ HTTPStatusCode() int }
+	return errors.As(err, &status) && status.HTTPStatusCode() == http.StatusRequestedRangeNotSatisfiable
+}
+
+// isMissingObject tells whether a probe of an object that may not exist
+// failed because it doesn't. S3 answers 403 instead of 404 for a missing
+// key to callers not allowed to list the bucket, so a denied probe is
+// taken as missing, the next required object reports a real denial.
+func isMissingObject(err error) bool {
+	return isTunnelNotExist(err) || errors.Is(err, ErrRemoteAuth)
+}
+
+// isTransientError tells whether a request failing with err, classified by
+// classifyRemoteError, may succeed if retried.
+func isTransientError(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, ErrTunnelNotExits), errors.Is(err, ErrRemoteAuth), errors.Is(err, errObjectChanged):
+		return false
+	case errors.Is(err, ErrRemoteThrottled):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return true
+	}
+
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) {
+		return status.HTTPStatusCode() >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// objectOpener opens the bytes [offset, end) of an object of the remote,
+// up to its end if end is negative, only if its ETag is still etag when not
+// empty. It returns the body, the ETag and the size of the whole object, -1
+// if unknown.
+type objectOpener func(ctx context.Context, offset int64, end int64, etag string) (io.ReadCloser, string, int64, error)
+
+// resumableObject reads an object, or a range of it, reopening it where it
+// stopped on transient errors as long as its ETag is unchanged.
+type resumableObject struct {
+	ctx       context.Context
+	open      objectOpener
+	opts      DownloadOptions
+	limiter   *downloadLimiter
+	name      string
+	body      io.ReadCloser
+	etag      string
+	size      int64
+	offset    int64
+	end       int64
+	attempt   int
+	closeOnce sync.Once
+}
+
+// openResumable opens an object, retrying transient errors. The stream
+// holds a slot of limiter until closed.
+func openResumable(ctx context.Context, name string, open objectOpener, opts DownloadOptions, limiter *downloadLimiter) (*resumableObject, error) {
+	return openResumableRange(ctx, name, open, opts, limiter, "", 0, -1)
+}
+
+// openResumableRange opens the bytes [offset, end) of the object whose ETag
+// is etag, retrying transient errors.
+func openResumableRange(ctx context.Context, name string, open objectOpener, opts DownloadOptions, limiter *downloadLimiter, etag string, offset int64, end int64) (*resumableObject, error) {
+	if err := limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	o := &resumableObject{
+		ctx:     ctx,
+		open:    open,
+		opts:    opts.withDefaults(),
+		limiter: limiter,
+		name:    name,
+		etag:    etag,
+		size:    -1,
+		offset:  offset,
+		end:     end,
+	}
+	if err := o.reopen(nil); err != nil {
+		limiter.release()
+		return nil, err
+	}
+	return o, nil
+}
+
+// reopen opens the object at the current offset, cause is the error of the
+// previous attempt if any.
+func (o *resumableObject) reopen(cause error) error {
+	for {
+		if cause != nil {
+			if !isTransientError(cause) || o.attempt >= o.opts.MaxAttempts {
+				return cause
+			}
+			backoff := o.opts.backoff(o.attempt)
+			log.Printf("[dynamic] download %s failed at %d bytes, retrying in %v: %v", o.name, o.offset, backoff, cause)
+			select {
+			case <-o.ctx.Done():
+				return o.ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		o.attempt++
+		body, etag, size, err := o.open(o.ctx, o.offset, o.end, o.etag)
+		if err != nil {
+			cause = classifyRemoteError(err)
+			continue
+		}
+		if o.etag == "" {
+			o.etag = etag
+		}
+		if o.size < 0 {
+			o.size = size
+		}
+		if o.end < 0 || (size >= 0 && o.end > size) {
+			o.end = size
+		}
+		o.body = body
+		return nil
+	}
+}
+
+func (o *resumableObject) Read(p []byte) (int, error) {
+	for {
+		n, err := o.body.Read(p)
+		o.offset += int64(n)
+		if werr := o.limiter.wait(o.ctx, n); werr != nil {
+			return n, werr
+		}
+		if err == io.EOF && o.end >= 0 && o.offset < o.end {
+			err = io.ErrUnexpectedEOF
+		}
+		if n > 0 {
+			// the attempts are counted since the last bytes received.
+			o.attempt = 1
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		o.body.Close()
+		if err := o.reopen(classifyRemoteError(err)); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (o *resumableObject) Close() error {
+	o.closeOnce.Do(o.limiter.release)
+	return o.body.Close()
+}
+
+// downloadParts downloads the object whose first part is opened as first
+// into file in parts of opts.PartSize, opts.PartConcurrency at a time. The
+// other parts are opened by open at the same ETag.
+func downloadParts(first *resumableObject, open objectOpener, opts DownloadOptions, file io.WriterAt, tracker *downloadTracker) error {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancel(first.ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	copyPart := func(r io.Reader, offset int64, end int64) {
+		written, err := io.Copy(io.NewOffsetWriter(file, offset), io.LimitReader(trackedReader{r, tracker}, end-offset))
+		if err != nil {
+			fail(err)
+		} else if written != end-offset {
+			fail(io.ErrUnexpectedEOF)
+		}
+	}
+
+	sem := make(chan struct{}, opts.PartConcurrency)
+	sem <- struct{}{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() { <-sem }()
+		defer first.Close()
+		copyPart(first, 0, min(opts.PartSize, first.size))
+	}()
+
+	for offset := opts.PartSize; offset < first.size; offset += opts.PartSize {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		end := min(offset+opts.PartSize, first.size)
+		wg.Add(1)
+		go func(offset int64, end int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			part, err := openResumableRange(ctx, first.name, open, opts, first.limiter, first.etag, offset, end)
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer part.Close()
+			copyPart(part, offset, end)
+		}(offset, end)
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// An object is downloaded into a partial file, suffixed with partialSuffix,
+// which is kept on failure for the next download to resume from. The size
+// and the ETag of the object it holds the beginning of are recorded next
+// to it, suffixed with partialStateSuffix. Only sequential downloads record
+// them, parts are written out of order and leave holes until all are done.
+const (
+	partialSuffix      = ".download"
+	partialStateSuffix = ".etag"
+)
+
+// readPartial returns the number of bytes of the partial file and the size
+// and ETag of their object, or zero bytes if it can't be resumed.
+func readPartial(partialPath string) (int64, int64, string) {
+	data, err := os.ReadFile(partialPath + partialStateSuffix)
+	if err != nil {
+		return 0, -1, ""
+	}
+	sizeText, etag, ok := strings.Cut(strings.TrimSpace(string(data)), " ")
+	size, err := strconv.ParseInt(sizeText, 10, 64)
+	if !ok || err != nil || etag == "" {
+		return 0, -1, ""
+	}
+	stat, err := os.Stat(partialPath)
+	if err != nil || stat.Size() > size {
+		return 0, -1, ""
+	}
+	return stat.Size(), size, etag
+}
+
+func removePartial(partialPath string) {
+	os.Remove(partialPath)
+	os.Remove(partialPath + partialStateSuffix)
+}
+
+// downloadObject downloads the object opened by open into partialPath,
+// resuming from the bytes already there when they are of the same ETag.
+// Objects larger than a part are downloaded in parallel parts when nothing
+// is there to resume. The download starts over once if the object changes
+// meanwhile.
+func downloadObject(ctx context.Context, name string, open objectOpener, opts DownloadOptions, limiter *downloadLimiter, partialPath string, track func(total int64) *downloadTracker) error {
+	err := downloadObjectOnce(ctx, name, open, opts, limiter, partialPath, track)
+	if errors.Is(err, errObjectChanged) {
+		log.Printf("[dynamic] %s changed while downloading, starting over", name)
+		removePartial(partialPath)
+		err = downloadObjectOnce(ctx, name, open, opts, limiter, partialPath, track)
+	}
+	return err
+}
+
+func downloadObjectOnce(ctx context.Context, name string, open objectOpener, opts DownloadOptions, limiter *downloadLimiter, partialPath string, track func(total int64) *downloadTracker) (err error) {
+	opts = opts.withDefaults()
+	offset, size, etag := readPartial(partialPath)
+	if etag != "" {
+		if offset == size {
+			return nil
+		}
+		log.Printf("[dynamic] resuming download %s at %d bytes", name, offset)
+	}
+
+	// a fresh download only asks for the first part, the size of the
+	// object tells whether there are others.
+	parallel := offset == 0 && opts.PartConcurrency > 1
+	end := int64(-1)
+	if parallel {
+		end = opts.PartSize
+	}
+	object, err := openResumableRange(ctx, name, open, opts, limiter, etag, offset, end)
+	if parallel && isInvalidRange(err) {
+		// S3 refuses any range of an empty object.
+		end = -1
+		object, err = openResumableRange(ctx, name, open, opts, limiter, etag, offset, end)
+	}
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	parted := end >= 0 && object.size > end
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if offset == 0 {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		// an object without ETag or size can't be resumed, nor can parts.
+		if err := os.Remove(partialPath + partialStateSuffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove file %q, %w", partialPath+partialStateSuffix, err)
+		}
+		if !parted && object.etag != "" && object.size >= 0 {
+			state := fmt.Sprintf("%d %s", object.size, object.etag)
+			if err := os.WriteFile(partialPath+partialStateSuffix, []byte(state), 0644); err != nil {
+				return fmt.Errorf("failed to write file %q, %w", partialPath+partialStateSuffix, err)
+			}
+		}
+	}
+	file, err := os.OpenFile(partialPath, flag, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file %q, %w", partialPath, err)
+	}
+	defer file.Close()
+
+	tracker := track(object.size)
+	tracker.add(offset)
+	defer func() { tracker.finish(err) }()
+
+	if parted {
+		log.Printf("[dynamic] downloading %s in parts of %d bytes", name, opts.PartSize)
+		if err := downloadParts(object, open, opts, file, tracker); err != nil {
+			// the parts leave holes, the partial file can't be resumed.
+			file.Close()
+			removePartial(partialPath)
+			return fmt.Errorf("failed to write file contents! %w", err)
+		}
+	} else {
+		written, err := io.Copy(file, trackedReader{object, tracker})
+		if err != nil {
+			return fmt.Errorf("failed to write file contents! %w", err)
+		} else if object.size >= 0 && offset+written != object.size {
+			return fmt.Errorf("wrote a different size than was given to us")
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file %q, %w", partialPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package dynamic_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+// useDownloadOptions sets opts until the test ends.
+func useDownloadOptions(t *testing.T, opts dynamic.DownloadOptions) {
+	dynamic.UseDownloadOptions(opts)
+	t.Cleanup(func() { dynamic.UseDownloadOptions(dynamic.DownloadOptions{}) })
+}
+
+var testDownloadToolchain = dynamic.ToolchainInfo{OS: "linux", Arch: "amd64v1", Compiler: "go1.24.0", Variant: "generic"}
+
+// putProcessPackage publishes the legacy process artifact of pkg@v1 and
+// returns its key.
+func putProcessPackage(s *fakeS3, pkg string, data []byte) string {
+	dynamic.UsePackageMode(pkg, dynamic.PackageModeProcess)
+	name := "default_" + pkg + "_v1"
+	key := testDownloadToolchain.String() + "/" + name + "/bin_" + name
+	s.Put(key, data)
+	return key
+}
+
+func prefetchV1(pkg string) error {
+	return dynamic.Prefetch(context.Background(), []dynamic.PackageRef{{Package: pkg, Version: "v1"}})
+}
+
+func TestDownload_RetriesThrottling(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{MaxAttempts: 3, MinBackoff: 20 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	key := putProcessPackage(s, "throttled", []byte("binary"))
+	s.Fail(key, 2, 503, "SlowDown")
+	startTime := time.Now()
+	if err := prefetchV1("throttled"); err != nil {
+		t.Fatalf("Prefetch throttled twice err=%v", err)
+	}
+	// each retry waits half the backoff at least.
+	if elapsed := time.Since(startTime); elapsed < 20*time.Millisecond {
+		t.Fatalf("Prefetch retried within %v, want a backoff", elapsed)
+	}
+
+	key = putProcessPackage(s, "overloaded", []byte("binary"))
+	s.Fail(key, 3, 503, "SlowDown")
+	if err := prefetchV1("overloaded"); !errors.Is(err, dynamic.ErrRemoteThrottled) {
+		t.Fatalf("Prefetch throttled 3 times err=%v want ErrRemoteThrottled", err)
+	}
+}
+
+func TestDownload_AuthNotRetried(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{MaxAttempts: 5, MinBackoff: time.Millisecond})
+
+	key := putProcessPackage(s, "denied", []byte("binary"))
+	s.Fail(key, 5, 403, "AccessDenied")
+	if err := prefetchV1("denied"); !errors.Is(err, dynamic.ErrRemoteAuth) {
+		t.Fatalf("Prefetch denied err=%v want ErrRemoteAuth", err)
+	}
+	if n := countRequests(s, "GET "+key); n != 1 {
+		t.Fatalf("denied object requested %d times, want 1", n)
+	}
+}
+
+func TestDownload_DeniedProbesAreMissing(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	s.denyMissing = true
+	s.Fail("", 100, 403, "AccessDenied")
+
+	key := putProcessPackage(s, "unlisted", []byte("binary"))
+	if err := prefetchV1("unlisted"); err != nil {
+		t.Fatalf("Prefetch without listing err=%v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(local, key)); err != nil || string(data) != "binary" {
+		t.Fatalf("synced file=%q,%v want %q", data, err, "binary")
+	}
+}
+
+func TestDownload_ResumesPartialFile(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{MaxAttempts: 1})
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	key := putProcessPackage(s, "resumed", data)
+	s.Truncate(key, 3000)
+	if err := prefetchV1("resumed"); err == nil {
+		t.Fatal("Prefetch of a truncated object err=nil")
+	}
+	if stat, err := os.Stat(filepath.Join(local, key+".download")); err != nil || stat.Size() != 3000 {
+		t.Fatalf("partial file=%v,%v want 3000 bytes kept", stat, err)
+	}
+
+	if err := prefetchV1("resumed"); err != nil {
+		t.Fatalf("Prefetch resuming err=%v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(local, key)); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("resumed file=%d bytes,%v want %d bytes", len(got), err, len(data))
+	}
+	if !slices.Contains(s.Requests(), "GET "+key+" bytes=3000-") {
+		t.Fatalf("requests=%q want a range from the partial file", s.Requests())
+	}
+	if _, err := os.Stat(filepath.Join(local, key+".download")); !os.IsNotExist(err) {
+		t.Fatalf("partial file left after download, stat err=%v", err)
+	}
+}
+
+func TestDownload_RestartsChangedObject(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{MaxAttempts: 1})
+
+	key := putProcessPackage(s, "changed", bytes.Repeat([]byte("old"), 1000))
+	s.Truncate(key, 1000)
+	if err := prefetchV1("changed"); err == nil {
+		t.Fatal("Prefetch of a truncated object err=nil")
+	}
+
+	data := bytes.Repeat([]byte("new"), 2000)
+	s.Put(key, data)
+	if err := prefetchV1("changed"); err != nil {
+		t.Fatalf("Prefetch of the changed object err=%v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(local, key)); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("file=%d bytes,%v want the %d bytes of the new object", len(got), err, len(data))
+	}
+}
+
+func TestDownload_Parts(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{PartSize: 1000, PartConcurrency: 2})
+
+	data := bytes.Repeat([]byte("0123456789"), 250)
+	key := putProcessPackage(s, "parts", data)
+	if err := prefetchV1("parts"); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(local, key)); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("file=%d bytes,%v want %d bytes", len(got), err, len(data))
+	}
+
+	want := []string{"GET " + key + " bytes=0-999", "GET " + key + " bytes=1000-1999", "GET " + key + " bytes=2000-2499"}
+	for _, req := range want {
+		if !slices.Contains(s.Requests(), req) {
+			t.Fatalf("requests=%q want %q", s.Requests(), want)
+		}
+	}
+	if n := countRequests(s, "GET "+key); n != len(want) {
+		t.Fatalf("requests=%q want only %q", s.Requests(), want)
+	}
+}
+
+func TestDownload_PartsNotResumed(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{MaxAttempts: 1, PartSize: 1000, PartConcurrency: 2})
+
+	data := bytes.Repeat([]byte("0123456789"), 250)
+	key := putProcessPackage(s, "killed", data)
+	partialPath := filepath.Join(local, key+".download")
+	s.delay.Store(int64(200 * time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- dynamic.Prefetch(ctx, []dynamic.PackageRef{{Package: "killed", Version: "v1"}})
+	}()
+
+	// the state of the parts in flight is what a crash would leave behind.
+	var partial []byte
+	for deadline := time.Now().Add(5 * time.Second); partial == nil; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("partial file of the parted download never created")
+		}
+		if _, err := os.Stat(partialPath); err == nil {
+			if _, err := os.Stat(partialPath + ".etag"); !os.IsNotExist(err) {
+				t.Fatalf("resume state of a parted download written, stat err=%v", err)
+			}
+			partial, _ = os.ReadFile(partialPath)
+		}
+	}
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("Prefetch of the killed download err=nil")
+	}
+	if err := os.WriteFile(partialPath, append(partial, make([]byte, len(data)-len(partial))...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := prefetchV1("killed"); err != nil {
+		t.Fatalf("Prefetch after the killed download err=%v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(local, key)); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("file=%d bytes,%v want %d bytes", len(got), err, len(data))
+	}
+	if n := countRequests(s, "GET "+key+" bytes=0-999"); n != 2 {
+		t.Fatalf("requests=%q want the first part downloaded again", s.Requests())
+	}
+}
+
+func TestDownload_PartsOfCompressedObject(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{PartSize: 100, PartConcurrency: 4})
+	dynamic.UsePackageMode("compressed", dynamic.PackageModeProcess)
+
+	// random bytes hardly compress, the object spans several parts.
+	data := make([]byte, 1000)
+	rand.Read(data)
+	dir := testDownloadToolchain.String() + "/default_compressed_v1"
+	manifest, _ := json.Marshal(dynamic.Manifest{Artifacts: []dynamic.Artifact{
+		{File: "bin_default_compressed_v1", Kind: dynamic.ArtifactProcess, Encoding: dynamic.EncodingGzip},
+	}})
+	s.Put(dir+"/manifest.json", manifest)
+	s.Put(dir+"/bin_default_compressed_v1.gz", gzipOf(t, data))
+
+	if err := prefetchV1("compressed"); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(local, dir, "bin_default_compressed_v1")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("file=%d bytes,%v want %d bytes", len(got), err, len(data))
+	}
+	if n := countRequests(s, "GET "+dir+"/bin_default_compressed_v1.gz bytes="); n < 2 {
+		t.Fatalf("requests=%q want the compressed object in parts", s.Requests())
+	}
+}
+
+func TestDownload_EmptyObject(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+
+	// S3 refuses the range of the first part, the object is asked whole.
+	key := putProcessPackage(s, "empty", nil)
+	if err := prefetchV1("empty"); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Fatalf("Prefetch of an empty object err=%v want an empty artifact", err)
+	}
+	if !slices.Contains(s.Requests(), "GET "+key) {
+		t.Fatalf("requests=%q want the object without range", s.Requests())
+	}
+}
+
+func countRequests(s *fakeS3, prefix string) int {
+	n := 0
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, prefix) {
+			n++
+		}
+	}
+	return n
+}
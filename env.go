@@ -2,21 +2,38 @@ package dynamic
 
 import (
 	"bufio"
-	"encoding/json"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"os/exec"
 	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
 	"unicode"
 )
 
-type Env struct{}
+type Env struct {
+	buildInfo func() (*debug.BuildInfo, bool)
+}
 
 var env = NewEnv()
 
 func NewEnv() *Env {
-	return &Env{}
+	return &Env{
+		buildInfo: hostBuildInfo,
+	}
+}
+
+// NewEnvOf returns an Env reading the build settings from info instead of
+// the running binary, nil standing for a binary without build info.
+func NewEnvOf(info *debug.BuildInfo) *Env {
+	return &Env{
+		buildInfo: func() (*debug.BuildInfo, bool) {
+			return info, info != nil
+		},
+	}
 }
 
 // GetOS returns a best-effort OS descriptor.
@@ -25,10 +42,7 @@ func NewEnv() *Env {
 // - On Darwin/macOS (best-effort): "darwin<version>" like "darwin14.2.1".
 // - Fallback: returns GOOS like "linux"/"darwin"/"windows".
 func (e *Env) GetOS() string {
-	goos := strings.ToLower(strings.TrimSpace(e.getGoEnvVar("GOOS")))
-	if goos == "" {
-		goos = strings.ToLower(strings.TrimSpace(runtime.GOOS))
-	}
+	goos := strings.ToLower(strings.TrimSpace(runtime.GOOS))
 
 	switch goos {
 	case "linux":
@@ -51,12 +65,19 @@ func (e *Env) GetOS() string {
 	}
 }
 
-func (*Env) getGoEnvVar(key string) string {
-	out, err := exec.Command("go", "env", key).Output()
-	if err != nil {
+// getBuildSetting returns a build setting of the running binary, e.g.
+// GOAMD64, which is what plugins have to be compatible with.
+func (e *Env) getBuildSetting(key string) string {
+	info, ok := e.buildInfo()
+	if !ok {
 		return ""
 	}
-	return strings.TrimSpace(string(out))
+	for _, s := range info.Settings {
+		if s.Key == key {
+			return strings.TrimSpace(s.Value)
+		}
+	}
+	return ""
 }
 
 func (*Env) detectLinuxDescriptor() string {
@@ -155,73 +176,83 @@ func (*Env) extractFirstVersionLikeToken(s string) string {
 	return s[start:end]
 }
 
-// GetArch returns current arch with best-effort variant.
-// Examples: amd64, armv7, arm64v8.
+// GetArch returns the arch of the running binary with its variant, read from
+// its build settings. Examples: amd64v1, armv7, arm64v8.
 func (e *Env) GetArch() string {
-	// Prefer `go env -json` so we only spawn `go` once and can assemble
-	// arch variants consistently (e.g. amd64v1, armv7, arm64v8).
-	env, ok := e.getGoEnvArchVars()
-	if ok {
-		goarch := strings.ToLower(strings.TrimSpace(env.GOARCH))
-		switch goarch {
-		case "":
-			// fall through to runtime below
-		case "amd64":
-			goamd64 := strings.ToLower(strings.TrimSpace(env.GOAMD64))
-			// GOAMD64 is typically "v1"/"v2"/"v3"/"v4".
-			if strings.HasPrefix(goamd64, "v") {
-				return "amd64" + goamd64
-			} else {
-				fmt.Printf("unexpected GOAMD64 value: %q", goamd64)
-			}
-			return "amd64"
-		case "arm":
-			goarm := strings.TrimSpace(env.GOARM)
-			if goarm != "" {
-				return "armv" + goarm
-			} else {
-				fmt.Println("unexpected GOARM empty value")
-			}
-			return "arm"
-		case "arm64":
-			// Go does not expose an arm64 variant; treat as v8 by default.
-			return "arm64v8"
-		default:
-			return goarch
-		}
+	goarch := strings.ToLower(e.getBuildSetting("GOARCH"))
+	if goarch == "" {
+		goarch = strings.ToLower(strings.TrimSpace(runtime.GOARCH))
 	}
 
-	// Fallback when `go` is unavailable.
-	goarch := strings.ToLower(strings.TrimSpace(runtime.GOARCH))
-	if goarch == "arm64" {
+	switch goarch {
+	case "amd64":
+		// GOAMD64 is "v1"/"v2"/"v3"/"v4", v1 when not set.
+		goamd64 := strings.ToLower(e.getBuildSetting("GOAMD64"))
+		if !strings.HasPrefix(goamd64, "v") {
+			goamd64 = "v1"
+		}
+		return "amd64" + goamd64
+	case "arm":
+		// GOARM is "5"/"6"/"7", optionally followed by ",softfloat" or ",hardfloat".
+		goarm, _, _ := strings.Cut(e.getBuildSetting("GOARM"), ",")
+		if goarm != "" {
+			return "armv" + goarm
+		}
+		return "arm"
+	case "arm64":
+		// Go does not expose an arm64 variant; treat as v8 by default.
 		return "arm64v8"
+	default:
+		return goarch
 	}
-	return goarch
 }
 
-type goEnvArchVars struct {
-	GOARCH  string `json:"GOARCH"`
-	GOAMD64 string `json:"GOAMD64"`
-	GOARM   string `json:"GOARM"`
+// GetCompiler returns the Go version the running binary was built with,
+// e.g. go1.20.5.
+func (e *Env) GetCompiler() string {
+	if info, ok := e.buildInfo(); ok && info.GoVersion != "" {
+		return strings.TrimSpace(info.GoVersion)
+	}
+	return strings.TrimSpace(runtime.Version())
 }
 
-func (*Env) getGoEnvArchVars() (goEnvArchVars, bool) {
-	out, err := exec.Command("go", "env", "-json").Output()
-	if err != nil {
-		return goEnvArchVars{}, false
-	}
-	var v goEnvArchVars
-	if err := json.Unmarshal(out, &v); err != nil {
-		return goEnvArchVars{}, false
-	}
-	return v, true
+// variantBuildSettings are the plugin relevant build settings not already
+// covered by the OS, arch and compiler of a toolchain.
+var variantBuildSettings = []string{
+	"-compiler",
+	"-tags",
+	"-trimpath",
+	"-race",
+	"-msan",
+	"-asan",
+	"CGO_ENABLED",
 }
 
-// GetCompiler returns `go env GOVERSION`, e.g. go1.20.5.
-func (*Env) GetCompiler() string {
-	out, err := exec.Command("go", "env", "GOVERSION").Output()
-	if err != nil {
-		return strings.TrimSpace(runtime.Version())
+// GetVariantSettings returns the variant build settings of the running
+// binary as sorted "key=value" pairs, tags sorted as well.
+func (e *Env) GetVariantSettings() []string {
+	settings := make([]string, 0, len(variantBuildSettings))
+	for _, key := range variantBuildSettings {
+		value := e.getBuildSetting(key)
+		if key == "-tags" && value != "" {
+			tags := strings.Split(value, ",")
+			sort.Strings(tags)
+			value = strings.Join(slices.Compact(tags), ",")
+		}
+		settings = append(settings, key+"="+value)
 	}
-	return strings.TrimSpace(string(out))
+	sort.Strings(settings)
+	return settings
+}
+
+// GetVariant returns a stable hash of the variant build settings,
+// e.g. "h3f9a0c12d4e1".
+func (e *Env) GetVariant() string {
+	return variantOf(e.GetVariantSettings())
+}
+
+// variantOf hashes sorted variant build settings.
+func variantOf(settings []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(settings, "\n")))
+	return "h" + hex.EncodeToString(sum[:6])
 }
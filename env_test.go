@@ -0,0 +1,98 @@
+package dynamic_test
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func buildInfoOf(goVersion string, settings ...string) *debug.BuildInfo {
+	info := &debug.BuildInfo{GoVersion: goVersion}
+	for _, s := range settings {
+		key, value, _ := strings.Cut(s, "=")
+		info.Settings = append(info.Settings, debug.BuildSetting{Key: key, Value: value})
+	}
+	return info
+}
+
+func TestEnv_GetArch(t *testing.T) {
+	tests := []struct {
+		settings []string
+		want     string
+	}{
+		{[]string{"GOARCH=amd64", "GOAMD64=v3"}, "amd64v3"},
+		{[]string{"GOARCH=amd64", "GOAMD64=v4"}, "amd64v4"},
+		{[]string{"GOARCH=amd64"}, "amd64v1"},
+		{[]string{"GOARCH=amd64", "GOAMD64="}, "amd64v1"},
+		{[]string{"GOARCH=arm", "GOARM=7"}, "armv7"},
+		{[]string{"GOARCH=arm", "GOARM=6,softfloat"}, "armv6"},
+		{[]string{"GOARCH=arm", "GOARM=5,hardfloat"}, "armv5"},
+		{[]string{"GOARCH=arm"}, "arm"},
+		{[]string{"GOARCH=arm64"}, "arm64v8"},
+		{[]string{"GOARCH=riscv64"}, "riscv64"},
+	}
+	for _, tt := range tests {
+		e := dynamic.NewEnvOf(buildInfoOf("go1.24.0", tt.settings...))
+		if got := e.GetArch(); got != tt.want {
+			t.Errorf("GetArch() with %q=%q want %q", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestEnv_NoBuildInfo(t *testing.T) {
+	e := dynamic.NewEnvOf(nil)
+
+	if got := e.GetOS(); got == "" {
+		t.Errorf("GetOS()=%q want the detected OS", got)
+	}
+	got := e.GetArch()
+	if !strings.HasPrefix(got, runtime.GOARCH) {
+		t.Errorf("GetArch()=%q want %s with its variant", got, runtime.GOARCH)
+	}
+	if runtime.GOARCH == "amd64" && got != "amd64v1" {
+		t.Errorf("GetArch()=%q want amd64v1 without GOAMD64", got)
+	}
+	if got := e.GetCompiler(); got != runtime.Version() {
+		t.Errorf("GetCompiler()=%q want %q", got, runtime.Version())
+	}
+
+	if got := dynamic.NewEnvOf(buildInfoOf("go1.99.1")).GetCompiler(); got != "go1.99.1" {
+		t.Errorf("GetCompiler()=%q want the go version of the build info", got)
+	}
+}
+
+func TestEnv_GetVariant(t *testing.T) {
+	base := []string{"-compiler=gc", "-tags=b,a", "-trimpath=true", "CGO_ENABLED=1", "GOARCH=amd64"}
+	variant := dynamic.NewEnvOf(buildInfoOf("go1.24.0", base...)).GetVariant()
+	if !strings.HasPrefix(variant, "h") || len(variant) != 13 {
+		t.Fatalf("GetVariant()=%q want h and 12 hex digits", variant)
+	}
+	if again := dynamic.NewEnvOf(buildInfoOf("go1.24.0", base...)).GetVariant(); again != variant {
+		t.Fatalf("GetVariant()=%q then %q want a stable hash", variant, again)
+	}
+
+	// tags in another order, and settings outside of the variant, keep it.
+	same := [][]string{
+		{"-compiler=gc", "-tags=a,b", "-trimpath=true", "CGO_ENABLED=1", "GOARCH=amd64"},
+		{"-compiler=gc", "-tags=b,a", "-trimpath=true", "CGO_ENABLED=1", "GOARCH=arm64", "vcs.revision=abc"},
+	}
+	for _, settings := range same {
+		if got := dynamic.NewEnvOf(buildInfoOf("go1.24.0", settings...)).GetVariant(); got != variant {
+			t.Errorf("GetVariant() with %q=%q want %q", settings, got, variant)
+		}
+	}
+
+	changed := [][]string{
+		{"-compiler=gc", "-tags=a", "-trimpath=true", "CGO_ENABLED=1"},
+		{"-compiler=gc", "-tags=b,a", "-trimpath=true", "CGO_ENABLED=0"},
+		{"-compiler=gc", "-tags=b,a", "CGO_ENABLED=1"},
+	}
+	for _, settings := range changed {
+		if got := dynamic.NewEnvOf(buildInfoOf("go1.24.0", settings...)).GetVariant(); got == variant {
+			t.Errorf("GetVariant() with %q=%q want another hash than %q", settings, got, variant)
+		}
+	}
+}
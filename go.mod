@@ -1,6 +1,6 @@
 module github.com/aura-studio/dynamic
 
-go 1.22
+go 1.22.0
 
 toolchain go1.24.0
 
@@ -8,6 +8,9 @@ require (
 	github.com/aws/aws-sdk-go-v2 v1.36.2
 	github.com/aws/aws-sdk-go-v2/config v1.18.4
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.77.1
+	github.com/klauspost/compress v1.18.0
+	github.com/tetratelabs/wazero v1.9.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 )
 
 require (
@@ -26,4 +29,5 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.13.9 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.17.6 // indirect
 	github.com/aws/smithy-go v1.22.2 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 )
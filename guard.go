@@ -0,0 +1,89 @@
+package dynamic
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrTunnelQuarantined = errors.New("dynamic: tunnel quarantined")
+
+// protect runs f and converts a panic into a *PanicError.
+func protect(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+	return f()
+}
+
+// Fault records the last panic of a tunnel and how many times it panicked.
+type Fault struct {
+	Err   error
+	Time  time.Time
+	Count int
+}
+
+// guardedTunnel isolates the host from panics in a loaded tunnel,
+// reporting them to onFault, and refuses invocations while check, if not
+// nil, fails, e.g. while the tunnel is quarantined.
+type guardedTunnel struct {
+	tunnel  TunnelV2
+	onFault func(error)
+	check   func() error
+}
+
+func newGuardedTunnel(tunnel TunnelV2, onFault func(error), check func() error) *guardedTunnel {
+	return &guardedTunnel{
+		tunnel:  tunnel,
+		onFault: onFault,
+		check:   check,
+	}
+}
+
+func (g *guardedTunnel) guard(f func() error) error {
+	err := protect(f)
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) && g.onFault != nil {
+		g.onFault(err)
+	}
+	return err
+}
+
+func (g *guardedTunnel) Unwrap() TunnelV2 {
+	return g.tunnel
+}
+
+func (g *guardedTunnel) Meta() (meta string) {
+	g.guard(func() error {
+		meta = g.tunnel.Meta()
+		return nil
+	})
+	return meta
+}
+
+func (g *guardedTunnel) Init(ctx context.Context) error {
+	return g.guard(func() error {
+		return g.tunnel.Init(ctx)
+	})
+}
+
+func (g *guardedTunnel) Invoke(ctx context.Context, method string, payload []byte) (out []byte, err error) {
+	if g.check != nil {
+		if err := g.check(); err != nil {
+			return nil, err
+		}
+	}
+	err = g.guard(func() error {
+		out, err = g.tunnel.Invoke(ctx, method, payload)
+		return err
+	})
+	return out, err
+}
+
+func (g *guardedTunnel) Close(ctx context.Context) error {
+	return g.guard(func() error {
+		return g.tunnel.Close(ctx)
+	})
+}
@@ -0,0 +1,76 @@
+package dynamic_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+type panicTunnel struct {
+	dynamic.Template
+	panicInit bool
+}
+
+func (t *panicTunnel) Init() {
+	if t.panicInit {
+		panic("init")
+	}
+}
+
+func (t *panicTunnel) Invoke(name string, args string) string {
+	panic("invoke")
+}
+
+func TestGuard_Panics(t *testing.T) {
+	var panicErr *dynamic.PanicError
+	if err := dynamic.TryRegisterPackage("guard-init", "v1", &panicTunnel{panicInit: true}); !errors.As(err, &panicErr) {
+		t.Fatalf("TryRegisterPackage err=%v want *PanicError", err)
+	}
+	if fault, ok := dynamic.PackageFault("guard-init", "v1"); !ok || fault.Count != 1 {
+		t.Fatalf("PackageFault after Init panic=%+v,%v want Count 1", fault, ok)
+	}
+
+	dynamic.RegisterPackage("guard-invoke", "v1", &panicTunnel{})
+	tunnel, err := dynamic.GetPackageV2("guard-invoke", "v1")
+	if err != nil {
+		t.Fatalf("GetPackageV2 err=%v", err)
+	}
+	if _, err := tunnel.Invoke(context.Background(), "any", nil); !errors.As(err, &panicErr) {
+		t.Fatalf("Invoke err=%v want *PanicError", err)
+	}
+	if _, ok := dynamic.PackageFault("guard-invoke", "v1"); !ok {
+		t.Fatalf("PackageFault after Invoke panic should be recorded")
+	}
+
+	dynamic.ResetPackageFault("guard-invoke", "v1")
+	if _, ok := dynamic.PackageFault("guard-invoke", "v1"); ok {
+		t.Fatalf("PackageFault after reset should be cleared")
+	}
+}
+
+func TestGuard_QuarantineRefusesCachedTunnel(t *testing.T) {
+	dynamic.UseQuarantine(time.Minute)
+	defer dynamic.UseQuarantine(0)
+
+	dynamic.RegisterPackage("guard-quarantine", "v1", &panicTunnel{})
+	tunnel, err := dynamic.GetPackageV2("guard-quarantine", "v1")
+	if err != nil {
+		t.Fatalf("GetPackageV2 err=%v", err)
+	}
+	var panicErr *dynamic.PanicError
+	if _, err := tunnel.Invoke(context.Background(), "any", nil); !errors.As(err, &panicErr) {
+		t.Fatalf("Invoke err=%v want *PanicError", err)
+	}
+	if _, err := tunnel.Invoke(context.Background(), "any", nil); !errors.Is(err, dynamic.ErrTunnelQuarantined) {
+		t.Fatalf("Invoke while quarantined err=%v want ErrTunnelQuarantined", err)
+	}
+
+	dynamic.ResetPackageFault("guard-quarantine", "v1")
+	if _, err := tunnel.Invoke(context.Background(), "any", nil); !errors.As(err, &panicErr) {
+		t.Fatalf("Invoke after reset err=%v want *PanicError", err)
+	}
+	dynamic.ResetPackageFault("guard-quarantine", "v1")
+}
@@ -0,0 +1,179 @@
+package dynamic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+type InvokeFunc func(ctx context.Context, method string, payload []byte) ([]byte, error)
+
+// Interceptor wraps the invocation of a tunnel method.
+type Interceptor func(next InvokeFunc) InvokeFunc
+
+// ChainInterceptors builds invoke wrapped by interceptors, the first one outermost.
+func ChainInterceptors(invoke InvokeFunc, interceptors ...Interceptor) InvokeFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		invoke = interceptors[i](invoke)
+	}
+	return invoke
+}
+
+// PanicError is returned in place of a panic raised by plugin code.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("dynamic: panic: %v\n%s", e.Value, e.Stack)
+}
+
+func newPanicError(v any) *PanicError {
+	return &PanicError{
+		Value: v,
+		Stack: debug.Stack(),
+	}
+}
+
+// RecoverInterceptor converts panics in the invocation into a *PanicError.
+func RecoverInterceptor() Interceptor {
+	return func(next InvokeFunc) InvokeFunc {
+		return func(ctx context.Context, method string, payload []byte) (out []byte, err error) {
+			err = protect(func() error {
+				out, err = next(ctx, method, payload)
+				return err
+			})
+			return out, err
+		}
+	}
+}
+
+// TimeoutInterceptor bounds each invocation by the timeout of its method in
+// methodTimeouts, or defaultTimeout otherwise. A zero timeout disables it.
+// v1 tunnels can't observe cancellation, so a timed out call keeps running
+// in the background while the caller gets the error.
+func TimeoutInterceptor(defaultTimeout time.Duration, methodTimeouts map[string]time.Duration) Interceptor {
+	return func(next InvokeFunc) InvokeFunc {
+		return func(ctx context.Context, method string, payload []byte) ([]byte, error) {
+			timeout, ok := methodTimeouts[method]
+			if !ok {
+				timeout = defaultTimeout
+			}
+			if timeout <= 0 {
+				return next(ctx, method, payload)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			type result struct {
+				out []byte
+				err error
+			}
+			done := make(chan result, 1)
+			go func() {
+				var out []byte
+				err := protect(func() (err error) {
+					out, err = next(ctx, method, payload)
+					return err
+				})
+				done <- result{out: out, err: err}
+			}()
+
+			select {
+			case r := <-done:
+				return r.out, r.err
+			case <-ctx.Done():
+				return nil, fmt.Errorf("dynamic: invoke %s timed out after %v, %w", method, timeout, ctx.Err())
+			}
+		}
+	}
+}
+
+// SlowCallInterceptor logs invocations that take longer than threshold.
+func SlowCallInterceptor(threshold time.Duration) Interceptor {
+	return func(next InvokeFunc) InvokeFunc {
+		return func(ctx context.Context, method string, payload []byte) ([]byte, error) {
+			startTime := time.Now()
+			out, err := next(ctx, method, payload)
+			if elapsed := time.Since(startTime); elapsed >= threshold {
+				log.Printf("[dynamic] slow invoke %s took %v", method, elapsed)
+			}
+			return out, err
+		}
+	}
+}
+
+// interceptedTunnel is the Tunnel handed out by GetPackage when interceptors are in use.
+type interceptedTunnel struct {
+	tunnel Tunnel
+	v2     *interceptedTunnelV2
+}
+
+func newInterceptedTunnel(tunnel Tunnel, interceptors []Interceptor) *interceptedTunnel {
+	v2 := AsTunnelV2(tunnel)
+	return &interceptedTunnel{
+		tunnel: tunnel,
+		v2: &interceptedTunnelV2{
+			tunnel: v2,
+			invoke: ChainInterceptors(v2.Invoke, interceptors...),
+		},
+	}
+}
+
+func (t *interceptedTunnel) Unwrap() Tunnel {
+	return t.tunnel
+}
+
+func (t *interceptedTunnel) TunnelV2() TunnelV2 {
+	return t.v2
+}
+
+func (t *interceptedTunnel) Meta() string {
+	return t.tunnel.Meta()
+}
+
+func (t *interceptedTunnel) Init() {
+	t.tunnel.Init()
+}
+
+func (t *interceptedTunnel) Invoke(name string, args string) string {
+	out, err := t.v2.invoke(context.Background(), name, []byte(args))
+	if err != nil {
+		log.Printf("[dynamic] invoke tunnel method %s failed: %v", name, err)
+		return ""
+	}
+	return string(out)
+}
+
+func (t *interceptedTunnel) Close() {
+	t.tunnel.Close()
+}
+
+type interceptedTunnelV2 struct {
+	tunnel TunnelV2
+	invoke InvokeFunc
+}
+
+func (t *interceptedTunnelV2) Unwrap() TunnelV2 {
+	return t.tunnel
+}
+
+func (t *interceptedTunnelV2) Meta() string {
+	return t.tunnel.Meta()
+}
+
+func (t *interceptedTunnelV2) Init(ctx context.Context) error {
+	return t.tunnel.Init(ctx)
+}
+
+func (t *interceptedTunnelV2) Invoke(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	return t.invoke(ctx, method, payload)
+}
+
+func (t *interceptedTunnelV2) Close(ctx context.Context) error {
+	return t.tunnel.Close(ctx)
+}
@@ -0,0 +1,103 @@
+package dynamic_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func TestInterceptors(t *testing.T) {
+	invoke := func(ctx context.Context, method string, payload []byte) ([]byte, error) {
+		switch method {
+		case "panic":
+			panic("boom")
+		case "sleep":
+			time.Sleep(50 * time.Millisecond)
+		}
+		return payload, nil
+	}
+
+	chained := dynamic.ChainInterceptors(invoke,
+		dynamic.RecoverInterceptor(),
+		dynamic.TimeoutInterceptor(0, map[string]time.Duration{"sleep": time.Millisecond}),
+	)
+
+	if out, err := chained(context.Background(), "echo", []byte("x")); err != nil || string(out) != "x" {
+		t.Fatalf("echo=%q,%v want %q,nil", out, err, "x")
+	}
+
+	var panicErr *dynamic.PanicError
+	if _, err := chained(context.Background(), "panic", nil); !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Fatalf("panic err=%v want *PanicError(boom)", err)
+	}
+
+	if _, err := chained(context.Background(), "sleep", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("sleep err=%v want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSlowCallInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	invoke := func(ctx context.Context, method string, payload []byte) ([]byte, error) {
+		if method == "sleep" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return payload, nil
+	}
+	chained := dynamic.ChainInterceptors(invoke, dynamic.SlowCallInterceptor(10*time.Millisecond))
+
+	if out, err := chained(context.Background(), "echo", []byte("x")); err != nil || string(out) != "x" {
+		t.Fatalf("echo=%q,%v want %q,nil", out, err, "x")
+	}
+	if strings.Contains(buf.String(), "slow invoke") {
+		t.Fatalf("fast call logged as slow: %q", buf.String())
+	}
+	if _, err := chained(context.Background(), "sleep", nil); err != nil {
+		t.Fatalf("sleep err=%v", err)
+	}
+	if !strings.Contains(buf.String(), "slow invoke sleep took") {
+		t.Fatalf("log=%q want the slow call", buf.String())
+	}
+}
+
+func TestUseInterceptor_WrapsPackages(t *testing.T) {
+	// the interceptor stays in use, it only acts on its own method.
+	var calls int
+	dynamic.UseInterceptor(func(next dynamic.InvokeFunc) dynamic.InvokeFunc {
+		return func(ctx context.Context, method string, payload []byte) ([]byte, error) {
+			if method != "intercepted" {
+				return next(ctx, method, payload)
+			}
+			calls++
+			out, err := next(ctx, method, payload)
+			return append(out, "!"...), err
+		}
+	})
+	dynamic.RegisterPackage("intercepted", "v1", &echoTunnel{})
+
+	tunnel, err := dynamic.GetPackage("intercepted", "v1")
+	if err != nil {
+		t.Fatalf("GetPackage err=%v", err)
+	}
+	if out := tunnel.Invoke("intercepted", "x"); out != "intercepted:x!" || calls != 1 {
+		t.Fatalf("Invoke=%q after %d calls want %q after 1", out, calls, "intercepted:x!")
+	}
+
+	tunnelV2, err := dynamic.GetPackageV2("intercepted", "v1")
+	if err != nil {
+		t.Fatalf("GetPackageV2 err=%v", err)
+	}
+	if out, err := tunnelV2.Invoke(context.Background(), "intercepted", []byte("y")); err != nil || string(out) != "intercepted:y!" || calls != 2 {
+		t.Fatalf("Invoke=%q,%v after %d calls want %q after 2", out, err, calls, "intercepted:y!")
+	}
+}
@@ -0,0 +1,253 @@
+package dynamic
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	LibcGlibc = "glibc"
+	LibcMusl  = "musl"
+)
+
+// Libc is the C library flavor and version the running binary is linked
+// against, cgo plugins depend on it.
+type Libc struct {
+	Flavor  string
+	Version string
+}
+
+// ParseLibc is the inverse of Libc.String, the version may be empty when
+// it couldn't be detected, e.g. "glibc".
+func ParseLibc(s string) (Libc, error) {
+	for _, flavor := range []string{LibcGlibc, LibcMusl} {
+		if version, ok := strings.CutPrefix(s, flavor); ok {
+			if version == "" {
+				return Libc{Flavor: flavor}, nil
+			}
+			if _, err := parseVersion(version); err != nil {
+				return Libc{}, fmt.Errorf("dynamic: invalid libc %q, %w", s, err)
+			}
+			return Libc{Flavor: flavor, Version: version}, nil
+		}
+	}
+	return Libc{}, fmt.Errorf("dynamic: invalid libc %q, want glibc<version> or musl<version>", s)
+}
+
+// String returns e.g. "glibc2.36", empty for a statically linked binary.
+func (l Libc) String() string {
+	return l.Flavor + l.Version
+}
+
+// LibcRule is a compatibility rule like "glibc >= 2.31": a host with a
+// newer libc of the flavor can load packages built against any version
+// down to Min.
+type LibcRule struct {
+	Flavor string
+	Min    string
+}
+
+func ParseLibcRule(s string) (LibcRule, error) {
+	flavor, min, ok := strings.Cut(s, ">=")
+	flavor, min = strings.TrimSpace(flavor), strings.TrimSpace(min)
+	if !ok || (flavor != LibcGlibc && flavor != LibcMusl) {
+		return LibcRule{}, fmt.Errorf("dynamic: invalid libc rule %q, want \"<glibc|musl> >= <version>\"", s)
+	}
+	if _, err := parseVersion(min); err != nil {
+		return LibcRule{}, fmt.Errorf("dynamic: invalid libc rule %q, %w", s, err)
+	}
+	return LibcRule{Flavor: flavor, Min: min}, nil
+}
+
+// Compatible returns l followed by the older libc versions allowed by rule,
+// newest first, counting down the last version component.
+func (l Libc) Compatible(rule LibcRule) []Libc {
+	libcs := []Libc{l}
+	if l.Flavor == "" || rule.Flavor != l.Flavor {
+		return libcs
+	}
+	version, err := parseVersion(l.Version)
+	if err != nil {
+		return libcs
+	}
+	min, _ := parseVersion(rule.Min)
+
+	last := len(version) - 1
+	for version[last] > 0 {
+		version[last]--
+		if compareVersion(version, min) < 0 {
+			break
+		}
+		libcs = append(libcs, Libc{Flavor: l.Flavor, Version: formatVersion(version)})
+	}
+	return libcs
+}
+
+func parseVersion(s string) ([]int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(s, ".")
+	version := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		version[i] = n
+	}
+	return version, nil
+}
+
+func formatVersion(version []int) string {
+	parts := make([]string, len(version))
+	for i, n := range version {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+func compareVersion(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+var glibcVersionRe = regexp.MustCompile(`GLIBC_2\.(\d+)`)
+
+var muslVersionRe = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// GetLibc detects the libc of the running binary from its ELF interpreter,
+// the zero Libc for static or non-ELF binaries. The version is read from
+// the sections of the libc mapped in the process, and left empty if it
+// can't be found there.
+func (*Env) GetLibc() Libc {
+	interp := elfInterp()
+	switch {
+	case interp == "":
+		return Libc{}
+	case strings.Contains(interp, "musl"):
+		// the musl loader is libc itself.
+		return Libc{Flavor: LibcMusl, Version: muslVersion(interp)}
+	default:
+		return Libc{Flavor: LibcGlibc, Version: glibcVersion(glibcPath(interp))}
+	}
+}
+
+// elfInterp returns the PT_INTERP of the running binary.
+func elfInterp() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	f, err := elf.Open(exe)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			return ""
+		}
+		return strings.TrimRight(string(data), "\x00")
+	}
+	return ""
+}
+
+// glibcPath returns the path of the libc mapped in the process, or else
+// the one next to the loader.
+func glibcPath(interp string) string {
+	if data, err := os.ReadFile("/proc/self/maps"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			// address perms offset dev inode path
+			fields := strings.Fields(line)
+			if len(fields) < 6 {
+				continue
+			}
+			path := fields[len(fields)-1]
+			if base := filepath.Base(path); strings.HasPrefix(base, "libc.so") || strings.HasPrefix(base, "libc-") {
+				return path
+			}
+		}
+	}
+	if resolved, err := filepath.EvalSymlinks(interp); err == nil {
+		interp = resolved
+	}
+	return filepath.Join(filepath.Dir(interp), "libc.so.6")
+}
+
+// glibcVersion returns the newest GLIBC_2.x symbol version the dynamic
+// string table of the glibc at path holds.
+func glibcVersion(path string) string {
+	data, ok := readSection(path, ".dynstr")
+	if !ok {
+		return ""
+	}
+	minor := -1
+	for _, m := range glibcVersionRe.FindAllSubmatch(data, -1) {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n > minor {
+			minor = n
+		}
+	}
+	if minor < 0 {
+		return ""
+	}
+	return "2." + strconv.Itoa(minor)
+}
+
+// muslVersion returns the version string musl keeps among its read-only
+// data, e.g. 1.2.4.
+func muslVersion(path string) string {
+	data, ok := readSection(path, ".rodata")
+	if !ok {
+		return ""
+	}
+	for _, s := range strings.Split(string(data), "\x00") {
+		if muslVersionRe.MatchString(s) {
+			return s
+		}
+	}
+	return ""
+}
+
+// readSection reads a section of the ELF file at path, up to 4MiB.
+func readSection(path string, name string) ([]byte, bool) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	section := f.Section(name)
+	if section == nil || section.Size > 4<<20 {
+		return nil, false
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,79 @@
+package dynamic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// downloadLimiter bounds the object streams open at once and the bytes
+// received per second by every download of a warehouse.
+type downloadLimiter struct {
+	slots chan struct{}
+
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+// newDownloadLimiter returns the limiter of opts, nil if it sets no limit.
+func newDownloadLimiter(opts DownloadOptions) *downloadLimiter {
+	if opts.MaxConcurrent <= 0 && opts.BytesPerSecond <= 0 {
+		return nil
+	}
+
+	l := &downloadLimiter{rate: opts.BytesPerSecond}
+	if opts.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, opts.MaxConcurrent)
+	}
+	return l
+}
+
+// acquire waits for a slot to open an object stream.
+func (l *downloadLimiter) acquire(ctx context.Context) error {
+	if l == nil || l.slots == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *downloadLimiter) release() {
+	if l == nil || l.slots == nil {
+		return
+	}
+	<-l.slots
+}
+
+// wait paces the receipt of n bytes to the bandwidth limit.
+func (l *downloadLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || l.rate <= 0 || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,43 @@
+package dynamic_test
+
+import (
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func TestDownloadLimiter_MaxConcurrent(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{MaxConcurrent: 2, PartSize: 100, PartConcurrency: 4})
+	s.delay.Store(int64(10 * time.Millisecond))
+
+	putProcessPackage(s, "limited", make([]byte, 1000))
+	if err := prefetchV1("limited"); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+	// 10 parts, 4 at a time without the limit.
+	if n := s.maxInFlight.Load(); n != 2 {
+		t.Fatalf("object requests in flight=%d want 2", n)
+	}
+}
+
+func TestDownloadLimiter_BytesPerSecond(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	useDownloadOptions(t, dynamic.DownloadOptions{BytesPerSecond: 10000})
+
+	putProcessPackage(s, "paced1", make([]byte, 3000))
+	putProcessPackage(s, "paced2", make([]byte, 3000))
+	startTime := time.Now()
+	for _, pkg := range []string{"paced1", "paced2"} {
+		if err := prefetchV1(pkg); err != nil {
+			t.Fatalf("Prefetch %s err=%v", pkg, err)
+		}
+	}
+	// the second object waits for the 3000 bytes of the first.
+	if elapsed := time.Since(startTime); elapsed < 250*time.Millisecond {
+		t.Fatalf("6000 bytes received in %v at 10000 bytes per second", elapsed)
+	}
+}
@@ -7,15 +7,25 @@ import (
 	"os"
 	"path/filepath"
 	"plugin"
+	"runtime"
+	"sync"
 )
 
 type Local struct {
 	localPath string
+	matches   *localMatches
+}
+
+// localMatches records the toolchain directories packages were found in.
+type localMatches struct {
+	mu      sync.RWMutex
+	matched map[string]string
 }
 
 func NewLocal(localPath string) *Local {
 	return &Local{
 		localPath: localPath,
+		matches:   &localMatches{matched: make(map[string]string)},
 	}
 }
 
@@ -23,33 +33,182 @@ func (l Local) Path() string {
 	return l.localPath
 }
 
-func (l Local) Exists(name string) bool {
-	localCgoFilePath := filepath.Join(l.Path(), toolchain.String(), name, fmt.Sprintf("libcgo_%s.so", name))
-	localGoFilePath := filepath.Join(l.Path(), toolchain.String(), name, fmt.Sprintf("libgo_%s.so", name))
-	log.Printf("[dynamic] check warehouse package %s go file: %s", name, localGoFilePath)
-	log.Printf("[dynamic] check warehouse package %s cgo file: %s", name, localCgoFilePath)
+// ToolchainDirs returns the warehouse directories that may hold packages
+// in mode, relative to the local and remote roots, best first.
+func ToolchainDirs(mode PackageMode) []string {
+	if mode == PackageModeWasm {
+		return []string{"wasm"}
+	}
+	return toolchain.Candidates()
+}
 
-	// libgo is required.
-	if stat, err := os.Stat(localGoFilePath); err != nil {
-		return false
-	} else if stat.Size() == 0 {
-		return false
+// Dir returns the local directory of a package in mode, under the toolchain
+// directory it was found in, or the exact toolchain if not found yet.
+func (l Local) Dir(name string, mode PackageMode) string {
+	if toolchainDir, ok := l.Matched(name); ok {
+		return l.DirOf(toolchainDir, name)
 	}
+	return l.DirOf(ToolchainDirs(mode)[0], name)
+}
+
+// DirOf returns the local directory of a package under toolchainDir.
+func (l Local) DirOf(toolchainDir string, name string) string {
+	return filepath.Join(l.Path(), toolchainDir, name)
+}
+
+// Matched returns the toolchain directory a package was found in.
+func (l Local) Matched(name string) (string, bool) {
+	l.matches.mu.RLock()
+	defer l.matches.mu.RUnlock()
 
-	// libcgo is required.
-	if stat, err := os.Stat(localCgoFilePath); err != nil {
-		return false
-	} else if stat.Size() == 0 {
-		return false
+	toolchainDir, ok := l.matches.matched[name]
+	return toolchainDir, ok
+}
+
+// Manifest returns the manifest of a package under toolchainDir, or the
+// legacy one of mode if it has none.
+func (l Local) Manifest(toolchainDir string, name string, mode PackageMode) *Manifest {
+	m, err := ReadManifest(l.DirOf(toolchainDir, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[dynamic] read warehouse package %s manifest failed: %v", name, err)
+		}
+		return DefaultManifest(name, mode)
+	}
+	return m
+}
+
+// ArtifactPath returns the path of the artifact of kind of a package in
+// mode, if it has one. A missing optional artifact is not reported.
+func (l Local) ArtifactPath(name string, mode PackageMode, kind ArtifactKind) (string, bool) {
+	toolchainDir, ok := l.Matched(name)
+	if !ok {
+		toolchainDir = ToolchainDirs(mode)[0]
+	}
+	a, ok := l.Manifest(toolchainDir, name, mode).Find(kind)
+	if !ok {
+		return "", false
 	}
+	path := filepath.Join(l.DirOf(toolchainDir, name), a.File)
+	if a.Optional {
+		if _, err := os.Stat(path); err != nil {
+			return "", false
+		}
+	}
+	return path, true
+}
+
+// ResetMatched forgets the toolchain directories packages were found in,
+// e.g. after the toolchain changed.
+func (l Local) ResetMatched() {
+	l.matches.mu.Lock()
+	defer l.matches.mu.Unlock()
+
+	l.matches.matched = make(map[string]string)
+}
+
+// Exists tells whether a package is available in the mode set by
+// UsePackageMode, see ExistsMode.
+func (l Local) Exists(name string) bool {
+	return l.ExistsMode(name, warehouse.Mode(name))
+}
+
+// ExistsMode probes the compatible toolchain directories for a package in
+// mode and records the first one holding every file.
+func (l Local) ExistsMode(name string, mode PackageMode) bool {
+	for _, toolchainDir := range ToolchainDirs(mode) {
+		if l.existsIn(toolchainDir, name, mode) {
+			l.matches.mu.Lock()
+			l.matches.matched[name] = toolchainDir
+			l.matches.mu.Unlock()
+			log.Printf("[dynamic] matched warehouse package %s toolchain: %s", name, toolchainDir)
+			return true
+		}
+	}
+	return false
+}
+
+func (l Local) existsIn(toolchainDir string, name string, mode PackageMode) bool {
+	for _, a := range l.Manifest(toolchainDir, name, mode).Artifacts {
+		localFilePath := filepath.Join(l.DirOf(toolchainDir, name), a.File)
+		log.Printf("[dynamic] check warehouse package %s file: %s", name, localFilePath)
+
+		// every artifact but optional ones is required.
+		if stat, err := os.Stat(localFilePath); err != nil {
+			if a.Optional && os.IsNotExist(err) {
+				continue
+			}
+			return false
+		} else if stat.Size() == 0 {
+			return false
+		} else if a.Size > 0 && stat.Size() != a.Size {
+			return false
+		}
+		if a.Kind == ArtifactAssets {
+			if _, err := os.Stat(filepath.Join(l.DirOf(toolchainDir, name), AssetsDirName)); err != nil {
+				return false
+			}
+		}
 
-	log.Printf("[dynamic] found warehouse package %s go file: %s", name, localGoFilePath)
-	log.Printf("[dynamic] found warehouse package %s cgo file: %s", name, localCgoFilePath)
+		log.Printf("[dynamic] found warehouse package %s file: %s", name, localFilePath)
+	}
 	return true
 }
 
+// AssetDir returns the asset directory of a package in mode, if it has one.
+func (l Local) AssetDir(name string, mode PackageMode) (string, bool) {
+	dir := filepath.Join(l.Dir(name, mode), AssetsDirName)
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// UnpackAssets unpacks the assets archive of a package under toolchainDir.
+func (l Local) UnpackAssets(toolchainDir string, name string, a Artifact) error {
+	dir := l.DirOf(toolchainDir, name)
+	if err := unpackAssets(filepath.Join(dir, a.File), dir); err != nil {
+		return err
+	}
+	log.Printf("[dynamic] unpacked warehouse package %s assets: %s", name, a.File)
+	return nil
+}
+
+// PluginPath returns the path of the Go plugin of a package.
+func (l Local) PluginPath(name string) (string, error) {
+	path, ok := l.ArtifactPath(name, PackageModePlugin, ArtifactGo)
+	if !ok {
+		return "", fmt.Errorf("dynamic: warehouse package %s has no go artifact", name)
+	}
+	return path, nil
+}
+
 func (l Local) Load(name string) (any, error) {
-	localGoFilePath := filepath.Join(l.Path(), toolchain.String(), name, fmt.Sprintf("libgo_%s.so", name))
+	localGoFilePath, err := l.PluginPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cgo library of the package, if any, must be loaded globally
+	// before the plugin that links against it.
+	if localCgoFilePath, ok := l.ArtifactPath(name, PackageModePlugin, ArtifactCgo); ok {
+		if err := preloadLibrary(localCgoFilePath); err != nil {
+			return nil, err
+		}
+		log.Printf("[dynamic] preloaded warehouse package %s cgo file: %s", name, localCgoFilePath)
+	}
+
+	// plugin.Open only reports the first mismatched package, check the
+	// whole build first to explain what differs. Only the mismatches the
+	// runtime rejects refuse the plugin, the others are left to it.
+	if report, err := CheckPlugin(localGoFilePath); err != nil {
+		log.Printf("[dynamic] skip check of warehouse package %s: %v", name, err)
+	} else if !report.Loadable() {
+		return nil, fmt.Errorf("dynamic: incompatible plugin, %s", report)
+	} else if !report.Compatible() {
+		log.Printf("[dynamic] warehouse package %s build differs from host, opening anyway: %s", name, report)
+	}
+
 	plug, err := plugin.Open(localGoFilePath)
 	if err != nil {
 		return nil, err
@@ -67,3 +226,36 @@ func (l Local) Load(name string) (any, error) {
 		return nil, err
 	}
 }
+
+// Start returns the process tunnel of a package, the process itself is
+// started when the tunnel is initialized.
+func (l Local) Start(name string, opts ProcessOptions) (TunnelV2, error) {
+	localFilePath, ok := l.ArtifactPath(name, PackageModeProcess, ArtifactProcess)
+	if !ok {
+		return nil, fmt.Errorf("dynamic: warehouse package %s has no process artifact", name)
+	}
+	if _, err := os.Stat(localFilePath); err != nil {
+		return nil, err
+	}
+	return NewProcessTunnel(localFilePath, opts), nil
+}
+
+// LoadWasm returns the wasm tunnel of a package, the module is compiled and
+// instantiated when the tunnel is initialized.
+func (l Local) LoadWasm(name string) (TunnelV2, error) {
+	localFilePath, ok := l.ArtifactPath(name, PackageModeWasm, ArtifactWasm)
+	if !ok {
+		return nil, fmt.Errorf("dynamic: warehouse package %s has no wasm artifact", name)
+	}
+	if _, err := os.Stat(localFilePath); err != nil {
+		return nil, err
+	}
+	return NewWasmTunnel(localFilePath), nil
+}
+
+func processFileName(name string) string {
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf("bin_%s.exe", name)
+	}
+	return fmt.Sprintf("bin_%s", name)
+}
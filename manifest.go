@@ -0,0 +1,162 @@
+package dynamic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestFileName is the file declaring the artifacts of a package, next
+// to them in the package directory. Packages without one are assumed to
+// have the legacy artifacts of their mode, see DefaultManifest.
+const ManifestFileName = "manifest.json"
+
+type ArtifactKind string
+
+const (
+	ArtifactGo      ArtifactKind = "go"
+	ArtifactCgo     ArtifactKind = "cgo"
+	ArtifactProcess ArtifactKind = "process"
+	ArtifactWasm    ArtifactKind = "wasm"
+	ArtifactData    ArtifactKind = "data"
+	// ArtifactAssets is a .tar or .tar.gz archive unpacked to the assets
+	// directory of the package, see AssetsDirName.
+	ArtifactAssets ArtifactKind = "assets"
+)
+
+// Artifact is a file of a package, relative to the package directory.
+// Size and SHA256 are those of the file and verified after download, and
+// decompression, when set. Optional artifacts may be missing, e.g. the cgo
+// library of a legacy package not using cgo. Encoding is the compression
+// of the object of the artifact on the remote, only that object is
+// downloaded, the raw file when empty. The legacy artifacts of a package
+// without manifest are downloaded from their zstd or gzip object when
+// published, falling back to the raw file.
+type Artifact struct {
+	File     string       `json:"file"`
+	Kind     ArtifactKind `json:"kind"`
+	Size     int64        `json:"size,omitempty"`
+	SHA256   string       `json:"sha256,omitempty"`
+	Optional bool         `json:"optional,omitempty"`
+	Encoding string       `json:"encoding,omitempty"`
+}
+
+// Object returns the file of the remote object of the artifact, relative to
+// the package directory.
+func (a Artifact) Object() string {
+	return a.File + encodingSuffixes[a.Encoding]
+}
+
+type Manifest struct {
+	Name      string     `json:"name,omitempty"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// DefaultManifest returns the legacy artifacts of a package in mode:
+// libgo_<name>.so and, if present, libcgo_<name>.so for plugins,
+// bin_<name> for processes and <name>.wasm for wasm.
+func DefaultManifest(name string, mode PackageMode) *Manifest {
+	m := &Manifest{Name: name}
+	switch mode {
+	case PackageModeProcess:
+		m.Artifacts = []Artifact{{File: processFileName(name), Kind: ArtifactProcess}}
+	case PackageModeWasm:
+		m.Artifacts = []Artifact{{File: fmt.Sprintf("%s.wasm", name), Kind: ArtifactWasm}}
+	default:
+		m.Artifacts = []Artifact{
+			{File: fmt.Sprintf("libcgo_%s.so", name), Kind: ArtifactCgo, Optional: true},
+			{File: fmt.Sprintf("libgo_%s.so", name), Kind: ArtifactGo},
+		}
+	}
+	return m
+}
+
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("dynamic: invalid manifest, %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ReadManifest reads the manifest of the package in dir, the error
+// satisfies os.IsNotExist if it has none.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// Validate checks that artifacts are known kinds of files inside the
+// package directory, and that data artifacts are not shipped under the
+// assets directory alongside an assets archive replacing it.
+func (m *Manifest) Validate() error {
+	_, archived := m.Find(ArtifactAssets)
+	for _, a := range m.Artifacts {
+		switch a.Kind {
+		case ArtifactGo, ArtifactCgo, ArtifactProcess, ArtifactWasm, ArtifactData, ArtifactAssets:
+		default:
+			return fmt.Errorf("dynamic: invalid manifest, unknown artifact kind %q", a.Kind)
+		}
+		if _, ok := encodingSuffixes[a.Encoding]; !ok {
+			return fmt.Errorf("dynamic: invalid manifest, unknown encoding %q of artifact %s", a.Encoding, a.File)
+		}
+		if !filepath.IsLocal(a.File) || filepath.Clean(a.File) == ManifestFileName {
+			return fmt.Errorf("dynamic: invalid manifest, artifact file %q", a.File)
+		}
+		inAssets := strings.SplitN(filepath.ToSlash(filepath.Clean(a.File)), "/", 2)[0] == AssetsDirName
+		if inAssets && (a.Kind == ArtifactAssets || archived) {
+			return fmt.Errorf("dynamic: invalid manifest, artifact file %q inside %s replaced by the assets archive", a.File, AssetsDirName)
+		}
+	}
+	return nil
+}
+
+// Find returns the first artifact of kind.
+func (m *Manifest) Find(kind ArtifactKind) (Artifact, bool) {
+	for _, a := range m.Artifacts {
+		if a.Kind == kind {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// Verify checks the size and checksum of the artifact downloaded at path.
+func (a Artifact) Verify(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	return a.verify(size, h.Sum(nil))
+}
+
+func (a Artifact) verify(size int64, sum []byte) error {
+	if size == 0 {
+		return fmt.Errorf("dynamic: artifact %s is empty", a.File)
+	}
+	if a.Size > 0 && size != a.Size {
+		return fmt.Errorf("dynamic: artifact %s size %d, want %d", a.File, size, a.Size)
+	}
+	if a.SHA256 != "" && hex.EncodeToString(sum) != a.SHA256 {
+		return fmt.Errorf("dynamic: artifact %s sha256 %x, want %s", a.File, sum, a.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package dynamic_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aura-studio/dynamic"
+)
+
+func TestParseManifest(t *testing.T) {
+	m, err := dynamic.ParseManifest([]byte(`{"name":"foo","artifacts":[{"file":"libgo_foo.so","kind":"go"},{"file":"assets/a.txt","kind":"data"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Find(dynamic.ArtifactCgo); ok {
+		t.Error("unexpected cgo artifact")
+	}
+	if a, ok := m.Find(dynamic.ArtifactGo); !ok || a.File != "libgo_foo.so" {
+		t.Errorf("go artifact %v", a)
+	}
+
+	for _, data := range []string{
+		`{"artifacts":[{"file":"../libgo_foo.so","kind":"go"}]}`,
+		`{"artifacts":[{"file":"/libgo_foo.so","kind":"go"}]}`,
+		`{"artifacts":[{"file":"manifest.json","kind":"data"}]}`,
+		`{"artifacts":[{"file":"libgo_foo.so","kind":"unknown"}]}`,
+		`{"artifacts":[{"file":"assets/assets.tar.gz","kind":"assets"}]}`,
+		`{"artifacts":[{"file":"assets.tar.gz","kind":"assets"},{"file":"assets/a.txt","kind":"data"}]}`,
+	} {
+		if _, err := dynamic.ParseManifest([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", data)
+		}
+	}
+}
+
+func TestArtifactVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "libgo_foo.so")
+	content := []byte("plugin")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+
+	a := dynamic.Artifact{File: "libgo_foo.so", Kind: dynamic.ArtifactGo, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])}
+	if err := a.Verify(path); err != nil {
+		t.Error(err)
+	}
+	a.Size++
+	if err := a.Verify(path); err == nil {
+		t.Error("expected size mismatch")
+	}
+	a.Size = 0
+	a.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	if err := a.Verify(path); err == nil {
+		t.Error("expected checksum mismatch")
+	}
+}
+
+func TestAssetDir(t *testing.T) {
+	if _, ok := dynamic.AssetDir(context.Background()); ok {
+		t.Error("unexpected asset dir")
+	}
+	ctx := dynamic.WithAssetDir(context.Background(), "/warehouse/foo/assets")
+	if dir, ok := dynamic.AssetDir(ctx); !ok || dir != "/warehouse/foo/assets" {
+		t.Errorf("asset dir %q", dir)
+	}
+}
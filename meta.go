@@ -0,0 +1,32 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// TunnelMeta is the structured form of Tunnel.Meta, encoded as a JSON object.
+// An empty or non-JSON Meta is treated as the zero TunnelMeta.
+type TunnelMeta struct {
+	Codec string `json:"codec,omitempty"`
+}
+
+func ParseTunnelMeta(s string) TunnelMeta {
+	var m TunnelMeta
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		return m
+	}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return TunnelMeta{}
+	}
+	return m
+}
+
+func (m TunnelMeta) String() string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,146 @@
+package dynamic
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats are the counters of the negative cache of missing packages.
+type CacheStats struct {
+	// Hits is the number of loads refused from the cache.
+	Hits uint64
+	// Misses is the number of loads the cache let through.
+	Misses uint64
+	// Stores is the number of packages recorded missing.
+	Stores uint64
+	// Entries is the number of packages currently recorded missing.
+	Entries int
+}
+
+// negativeCacheSize is the number of packages the negative cache remembers
+// at most, those expiring first are forgotten to make room.
+const negativeCacheSize = 1024
+
+type negativeKey struct {
+	name      string
+	toolchain string
+}
+
+// negativeCache remembers the packages the remote doesn't have, per
+// toolchain, to stop asking for them until their TTL expires.
+type negativeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[negativeKey]time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	stores atomic.Uint64
+}
+
+func newNegativeCache() *negativeCache {
+	return &negativeCache{
+		entries: make(map[negativeKey]time.Time),
+	}
+}
+
+// UseTTL sets how long a missing package is remembered, zero disables the
+// cache and forgets every entry.
+func (c *negativeCache) UseTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl = ttl
+	if ttl <= 0 {
+		c.entries = make(map[negativeKey]time.Time)
+	}
+}
+
+// Missing tells whether the package is remembered missing for toolchainDir.
+func (c *negativeCache) Missing(name string, toolchainDir string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return false
+	}
+
+	key := negativeKey{name, toolchainDir}
+	if expiry, ok := c.entries[key]; ok {
+		if time.Now().Before(expiry) {
+			c.hits.Add(1)
+			return true
+		}
+		delete(c.entries, key)
+	}
+	c.misses.Add(1)
+	return false
+}
+
+// Store remembers the package missing for toolchainDir.
+func (c *negativeCache) Store(name string, toolchainDir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	key := negativeKey{name, toolchainDir}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= negativeCacheSize {
+		c.evict(now)
+	}
+	c.entries[key] = now.Add(c.ttl)
+	c.stores.Add(1)
+}
+
+// evict forgets the expired packages, or the one expiring first if none is.
+func (c *negativeCache) evict(now time.Time) {
+	var first negativeKey
+	var firstExpiry time.Time
+	for key, expiry := range c.entries {
+		if !now.Before(expiry) {
+			delete(c.entries, key)
+		} else if firstExpiry.IsZero() || expiry.Before(firstExpiry) {
+			first, firstExpiry = key, expiry
+		}
+	}
+	if len(c.entries) >= negativeCacheSize {
+		delete(c.entries, first)
+	}
+}
+
+// Forget forgets the package for every toolchain, e.g. once it is published.
+func (c *negativeCache) Forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if key.name == name {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Reset forgets every package.
+func (c *negativeCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[negativeKey]time.Time)
+}
+
+func (c *negativeCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Stores:  c.stores.Load(),
+		Entries: entries,
+	}
+}
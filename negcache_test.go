@@ -0,0 +1,103 @@
+package dynamic_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+// useNegativeCache sets ttl until the test ends.
+func useNegativeCache(t *testing.T, ttl time.Duration) {
+	dynamic.UseNegativeCache(ttl)
+	t.Cleanup(func() { dynamic.UseNegativeCache(0) })
+}
+
+func TestNegativeCache(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	useNegativeCache(t, 100*time.Millisecond)
+	dynamic.UsePackageMode("unpublished", dynamic.PackageModeProcess)
+	// v1 is not prefetched from the default version when missing.
+	dynamic.UseDefaultVersion("v1")
+	t.Cleanup(func() { dynamic.UseDefaultVersion(dynamic.VersionDefault) })
+
+	stats := dynamic.NegativeCacheStats()
+	if err := prefetchV1("unpublished"); !errors.Is(err, dynamic.ErrTunnelNotExits) {
+		t.Fatalf("Prefetch of a missing package err=%v want ErrTunnelNotExits", err)
+	}
+	requests := len(s.Requests())
+	if err := prefetchV1("unpublished"); err == nil || !strings.Contains(err.Error(), "cached as missing") {
+		t.Fatalf("Prefetch again err=%v want cached as missing", err)
+	}
+	if n := len(s.Requests()); n != requests {
+		t.Fatalf("remote asked again for a cached package: %q", s.Requests()[requests:])
+	}
+	got := dynamic.NegativeCacheStats()
+	if got.Stores != stats.Stores+1 || got.Hits != stats.Hits+1 || got.Misses != stats.Misses+1 || got.Entries != 1 {
+		t.Fatalf("NegativeCacheStats=%+v want one more store, hit and miss from %+v", got, stats)
+	}
+
+	// the remote is asked again once the entry expires.
+	time.Sleep(100 * time.Millisecond)
+	if err := prefetchV1("unpublished"); err == nil || strings.Contains(err.Error(), "cached as missing") {
+		t.Fatalf("Prefetch after the ttl err=%v want the remote asked", err)
+	}
+	if n := len(s.Requests()); n == requests {
+		t.Fatal("remote not asked after the ttl")
+	}
+
+	// a package forgotten once published is synced right away.
+	putProcessPackage(s, "unpublished", []byte("binary"))
+	dynamic.InvalidateNegativeCache("unpublished", "v1")
+	if err := prefetchV1("unpublished"); err != nil {
+		t.Fatalf("Prefetch after InvalidateNegativeCache err=%v", err)
+	}
+	if n := dynamic.NegativeCacheStats().Entries; n != 0 {
+		t.Fatalf("NegativeCacheStats.Entries=%d want 0", n)
+	}
+}
+
+func TestNegativeCache_LocalPackage(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	useNegativeCache(t, time.Hour)
+	dynamic.UsePackageMode("copied", dynamic.PackageModeProcess)
+
+	if err := prefetchV1("copied"); !errors.Is(err, dynamic.ErrTunnelNotExits) {
+		t.Fatalf("Prefetch of a missing package err=%v want ErrTunnelNotExits", err)
+	}
+
+	// a package put in the local warehouse meanwhile is not refused.
+	dir := filepath.Join(local, testDownloadToolchain.String(), "default_copied_v1")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin_default_copied_v1"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := prefetchV1("copied"); err != nil {
+		t.Fatalf("Prefetch of a local package cached as missing err=%v", err)
+	}
+}
+
+func TestNegativeCache_Size(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	useNegativeCache(t, time.Hour)
+
+	refs := make([]dynamic.PackageRef, 1100)
+	for i := range refs {
+		refs[i] = dynamic.PackageRef{Package: fmt.Sprintf("crowd%d", i), Version: "v1"}
+	}
+	dynamic.Prefetch(context.Background(), refs)
+	if n := dynamic.NegativeCacheStats().Entries; n != 1024 {
+		t.Fatalf("NegativeCacheStats.Entries=%d want 1024 at most", n)
+	}
+}
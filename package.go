@@ -27,6 +27,16 @@ func NewDynamicIndex(namespace, pkg, version string) *DynamicIndex {
 	}
 }
 
+// ParseDynamicIndex is the inverse of DynamicIndex.String. Namespaces,
+// packages and versions are keywords, so they never contain "_".
+func ParseDynamicIndex(s string) (*DynamicIndex, bool) {
+	parts := strings.Split(s, "_")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	return NewDynamicIndex(parts[0], parts[1], parts[2]), true
+}
+
 func (d DynamicIndex) String() string {
 	return strings.Join([]string{d.Namespace, d.Package, d.Version}, "_")
 }
@@ -52,6 +62,7 @@ type DynamicCenter struct {
 	defaultVersion string
 	mu             sync.Mutex
 	dynamics       map[DynamicIndex]*Dynamic
+	interceptors   []Interceptor
 }
 
 var packageCenter = NewPackageCenter()
@@ -72,10 +83,35 @@ func (dc *DynamicCenter) UseDefaultVersion(v string) {
 	dc.defaultVersion = v
 }
 
-func (dc *DynamicCenter) GetTunnel(pkg string, version string) (tunnel Tunnel, err error) {
+func (dc *DynamicCenter) DefaultVersion() string {
+	return dc.defaultVersion
+}
+
+// UseInterceptor wraps the tunnels returned by GetTunnel with interceptors,
+// in addition to the ones already in use.
+func (dc *DynamicCenter) UseInterceptor(interceptors ...Interceptor) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	dc.interceptors = append(dc.interceptors, interceptors...)
+}
+
+func (dc *DynamicCenter) GetTunnel(pkg string, version string) (Tunnel, error) {
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
 
+	tunnel, err := dc.getTunnel(pkg, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dc.interceptors) > 0 {
+		return newInterceptedTunnel(tunnel, dc.interceptors), nil
+	}
+	return tunnel, nil
+}
+
+func (dc *DynamicCenter) getTunnel(pkg string, version string) (Tunnel, error) {
 	var index DynamicIndex
 
 	// first try with provided version
@@ -113,25 +149,70 @@ func (dc *DynamicCenter) GetTunnel(pkg string, version string) (tunnel Tunnel, e
 	return nil, fmt.Errorf("dynamic: both provided version and default version not found, package: %s, provided version: %s, default version: %s", pkg, version, dc.defaultVersion)
 }
 
+// LookupTunnel returns the tunnel of a loaded package without loading it.
+func (dc *DynamicCenter) LookupTunnel(pkg string, version string) (Tunnel, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if dynamic, ok := dc.dynamics[*NewDynamicIndex(dc.namesapce, pkg, version)]; ok {
+		return dynamic.GetTunnel(), true
+	}
+	return nil, false
+}
+
 func (dc *DynamicCenter) ClosePackage(pkg string, version string) {
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
 
 	index := *NewDynamicIndex(dc.namesapce, pkg, version)
 	if dynamic, ok := dc.dynamics[index]; ok {
-		if dynamic != nil {
+		delete(dc.dynamics, index)
+		// closing through the tunnel center unloads the package, so wasm
+		// and process packages can be loaded again afresh.
+		if tunnelCenter.HasTunnel(index.String()) {
+			if err := tunnelCenter.CloseTunnel(index.String()); err != nil {
+				log.Printf("[dynamic] close tunnel %s failed: %v", index.String(), err)
+			}
+		} else if dynamic != nil {
 			dynamic.GetTunnel().Close()
 		}
-		delete(dc.dynamics, index)
 	}
 }
 
 func (dc *DynamicCenter) RegisterPackage(pkg string, version string, tunnel Tunnel) {
+	if err := dc.TryRegisterPackage(pkg, version, tunnel); err != nil {
+		log.Printf("[dynamic] register package %s@%s failed: %v", pkg, version, err)
+	}
+}
+
+// TryRegisterPackage is RegisterPackage returning the error of Init.
+func (dc *DynamicCenter) TryRegisterPackage(pkg string, version string, tunnel Tunnel) error {
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
 
-	index := dc.cache(pkg, version, tunnel)
-	tunnelCenter.RegisterTunnel(index.String(), tunnel)
+	index := *NewDynamicIndex(dc.namesapce, pkg, version)
+	tunnel, err := tunnelCenter.TryRegisterTunnel(index.String(), tunnel)
+	if err != nil {
+		return err
+	}
+	dc.cache(pkg, version, tunnel)
+
+	return nil
+}
+
+// IndexName returns the DynamicIndex string of pkg@version in the namespace.
+func (dc *DynamicCenter) IndexName(pkg string, version string) string {
+	return NewDynamicIndex(dc.namesapce, pkg, version).String()
+}
+
+// Fault returns the last recorded panic of the package's tunnel.
+func (dc *DynamicCenter) Fault(pkg string, version string) (Fault, bool) {
+	return tunnelCenter.Fault(dc.IndexName(pkg, version))
+}
+
+// ResetFault forgets the panics of the package's tunnel, lifting its quarantine.
+func (dc *DynamicCenter) ResetFault(pkg string, version string) {
+	tunnelCenter.ResetFault(dc.IndexName(pkg, version))
 }
 
 func (dc *DynamicCenter) cache(pkg string, version string, tunnel Tunnel) DynamicIndex {
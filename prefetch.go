@@ -0,0 +1,164 @@
+package dynamic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// PackageRef names a version of a package to prefetch. As for GetPackage,
+// the default version is prefetched instead when the version can't be.
+type PackageRef struct {
+	Package string
+	Version string
+	// Load also opens the package and initializes its tunnel once synced,
+	// as GetPackage would.
+	Load bool
+}
+
+func (r PackageRef) String() string {
+	return r.Package + "@" + r.Version
+}
+
+// prefetchConcurrency is the number of packages prefetched at once.
+const prefetchConcurrency = 8
+
+// prefetch syncs the packages in parallel, prefetchConcurrency at a time,
+// and then loads those asking for it, returning every failure. It returns
+// early with the error of ctx if it is done first, which stops the syncs
+// but not the loads in progress.
+func prefetch(ctx context.Context, refs []PackageRef) error {
+	errs := make([]error, len(refs))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, prefetchConcurrency)
+		for i, ref := range refs {
+			wg.Add(1)
+			go func(i int, ref PackageRef) {
+				defer wg.Done()
+
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					errs[i] = ctx.Err()
+					return
+				}
+				defer func() { <-sem }()
+				errs[i] = prefetchPackage(ctx, ref)
+			}(i, ref)
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+		return errors.Join(errs...)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func prefetchPackage(ctx context.Context, ref PackageRef) error {
+	startTime := time.Now()
+	name := packageCenter.IndexName(ref.Package, ref.Version)
+
+	// registered and loaded packages are served without the warehouse.
+	_, loaded := packageCenter.LookupTunnel(ref.Package, ref.Version)
+	if warehouse.Local != nil && !loaded {
+		if err := warehouse.Sync(ctx, name); err != nil {
+			// GetPackage serves the package from the default version instead.
+			defaultVersion := packageCenter.DefaultVersion()
+			if ctx.Err() != nil || ref.Version == defaultVersion {
+				return fmt.Errorf("dynamic: prefetch %s failed, %w", ref, err)
+			}
+			log.Printf("[dynamic] prefetch %s failed, trying default version %s: %v", ref, defaultVersion, err)
+			if _, loaded := packageCenter.LookupTunnel(ref.Package, defaultVersion); !loaded {
+				if defaultErr := warehouse.Sync(ctx, packageCenter.IndexName(ref.Package, defaultVersion)); defaultErr != nil {
+					return fmt.Errorf("dynamic: prefetch %s failed, %w", ref, errors.Join(err, defaultErr))
+				}
+			}
+		}
+	}
+	if ref.Load {
+		// loads are serialized by the centers, the downloads are not.
+		if _, err := packageCenter.GetTunnel(ref.Package, ref.Version); err != nil {
+			return fmt.Errorf("dynamic: prefetch %s failed, %w", ref, err)
+		}
+	}
+
+	log.Printf("[dynamic] prefetched package %s in %v", ref, time.Since(startTime))
+	return nil
+}
+
+// prefetchRun is a prefetch started by UsePrefetch.
+type prefetchRun struct {
+	done chan struct{}
+	err  error
+}
+
+// Readiness tracks the prefetches started at startup.
+type Readiness struct {
+	mu   sync.Mutex
+	runs []*prefetchRun
+}
+
+var readiness = &Readiness{}
+
+// Start prefetches refs in the background.
+func (r *Readiness) Start(refs []PackageRef) {
+	run := &prefetchRun{done: make(chan struct{})}
+	r.mu.Lock()
+	r.runs = append(r.runs, run)
+	r.mu.Unlock()
+
+	go func() {
+		defer close(run.done)
+		run.err = prefetch(context.Background(), refs)
+		if run.err != nil {
+			log.Printf("[dynamic] prefetch failed: %v", run.err)
+		}
+	}()
+}
+
+// Ready tells whether every prefetch is done and succeeded.
+func (r *Readiness) Ready() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, run := range r.runs {
+		select {
+		case <-run.done:
+			if run.err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Wait waits for every prefetch and returns their failures, or the error of
+// ctx if it is done first.
+func (r *Readiness) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	runs := append([]*prefetchRun(nil), r.runs...)
+	r.mu.Unlock()
+
+	var errs []error
+	for _, run := range runs {
+		select {
+		case <-run.done:
+			errs = append(errs, run.err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
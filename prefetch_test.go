@@ -0,0 +1,117 @@
+package dynamic_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func TestPrefetch(t *testing.T) {
+	dynamic.RegisterPackage("prefetch", "v1", &echoTunnel{})
+
+	if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{
+		{Package: "prefetch", Version: "v1", Load: true},
+	}); err != nil {
+		t.Fatalf("Prefetch err=%v want nil", err)
+	}
+
+	if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{
+		{Package: "prefetch-missing", Version: "v1", Load: true},
+	}); err == nil {
+		t.Fatal("Prefetch of a missing package err=nil")
+	}
+}
+
+func TestUsePrefetch(t *testing.T) {
+	dynamic.RegisterPackage("prefetch-startup", "v1", &echoTunnel{})
+	dynamic.UsePrefetch(dynamic.PackageRef{Package: "prefetch-startup", Version: "v1", Load: true})
+
+	if err := dynamic.WaitReady(context.Background()); err != nil {
+		t.Fatalf("WaitReady err=%v want nil", err)
+	}
+	if !dynamic.Ready() {
+		t.Fatal("Ready=false after WaitReady")
+	}
+}
+
+func TestPrefetch_SyncsOncePerPackage(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	s.delay.Store(int64(20 * time.Millisecond))
+
+	key := putProcessPackage(s, "shared", []byte("binary"))
+	ref := dynamic.PackageRef{Package: "shared", Version: "v1"}
+	if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{ref, ref, ref, ref}); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+	if n := countRequests(s, "GET "+key); n != 1 {
+		t.Fatalf("requests=%q want the package downloaded once", s.Requests())
+	}
+}
+
+func TestPrefetch_Concurrency(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	s.delay.Store(int64(20 * time.Millisecond))
+
+	var refs []dynamic.PackageRef
+	for i := 0; i < 20; i++ {
+		pkg := fmt.Sprintf("many%d", i)
+		putProcessPackage(s, pkg, []byte("binary"))
+		refs = append(refs, dynamic.PackageRef{Package: pkg, Version: "v1"})
+	}
+	if err := dynamic.Prefetch(context.Background(), refs); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+	if n := s.maxInFlight.Load(); n < 2 || n > 8 {
+		t.Fatalf("object requests in flight=%d want 2 to 8", n)
+	}
+}
+
+func TestPrefetch_Canceled(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+	useNegativeCache(t, time.Hour)
+	s.delay.Store(int64(200 * time.Millisecond))
+
+	putProcessPackage(s, "slow", []byte("binary"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := dynamic.Prefetch(ctx, []dynamic.PackageRef{{Package: "slow", Version: "v1"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Prefetch err=%v want context.DeadlineExceeded", err)
+	}
+
+	// the stopped sync is neither shared nor cached as missing.
+	s.delay.Store(0)
+	if err := prefetchV1("slow"); err != nil {
+		t.Fatalf("Prefetch after a canceled one err=%v", err)
+	}
+}
+
+func TestPrefetch_DefaultVersion(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, testDownloadToolchain)
+	dynamic.UsePackageMode("fallback", dynamic.PackageModeProcess)
+
+	name := "default_fallback_" + dynamic.VersionDefault
+	key := testDownloadToolchain.String() + "/" + name + "/bin_" + name
+	s.Put(key, []byte("binary"))
+
+	// as GetPackage, a missing version is served from the default one.
+	if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{{Package: "fallback", Version: "v2"}}); err != nil {
+		t.Fatalf("Prefetch of a missing version err=%v want the default version", err)
+	}
+	if _, err := os.Stat(filepath.Join(local, key)); err != nil {
+		t.Fatalf("default version not synced, stat err=%v", err)
+	}
+
+	if err := prefetchV1("fallback-missing"); err == nil {
+		t.Fatal("Prefetch of a package missing in both versions err=nil")
+	}
+}
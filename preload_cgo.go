@@ -0,0 +1,31 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package dynamic
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+
+static void* dynamic_dlopen(const char* path) {
+	return dlopen(path, RTLD_NOW | RTLD_GLOBAL);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// preloadLibrary opens the shared library at path with RTLD_GLOBAL so its
+// symbols resolve for the Go plugin opened after it. It is never closed.
+func preloadLibrary(path string) error {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	if C.dynamic_dlopen(cpath) == nil {
+		return fmt.Errorf("dynamic: preload %s, %s", path, C.GoString(C.dlerror()))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package dynamic
+
+import "fmt"
+
+func preloadLibrary(path string) error {
+	return fmt.Errorf("dynamic: preload %s, not supported without cgo on this platform", path)
+}
@@ -0,0 +1,450 @@
+package dynamic
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrProcessExited is returned by calls to a process tunnel whose child is
+// not running, including the calls in flight when it crashed. It is retryable
+// once the supervisor has restarted the child.
+var ErrProcessExited = errors.New("dynamic: process exited")
+
+const (
+	EnvRLimitMemory = "DYNAMIC_RLIMIT_MEMORY"
+	EnvRLimitCPU    = "DYNAMIC_RLIMIT_CPU"
+	// EnvRLimitExec is the package a host started as an rlimit wrapper
+	// executes once the limits are set.
+	EnvRLimitExec = "DYNAMIC_RLIMIT_EXEC"
+)
+
+type ProcessTransport int
+
+const (
+	ProcessTransportStdio ProcessTransport = iota
+	ProcessTransportUnix
+)
+
+// ProcessOptions configures how process packages are started and supervised.
+type ProcessOptions struct {
+	Transport ProcessTransport
+	// StartTimeout bounds the startup of the child: connecting on the Unix
+	// socket, Init and the Meta health check.
+	StartTimeout time.Duration
+	// Restart restarts the child with exponential backoff from MinBackoff
+	// to MaxBackoff when it exits without being closed, at most MaxRestarts
+	// times in a row if positive.
+	Restart     bool
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxRestarts int
+	// MemoryLimit (bytes of address space) and CPULimit (CPU time, rounded
+	// up to the second, at least 1s) are set as rlimits of the child on
+	// Linux and macOS, by running it through the host executable as a wrapper
+	// that sets them before executing the package. They are ignored
+	// elsewhere. Zero means unlimited.
+	MemoryLimit uint64
+	CPULimit    time.Duration
+}
+
+// Validate rejects limits the child can't run with.
+func (o ProcessOptions) Validate() error {
+	if o.CPULimit < 0 || o.CPULimit > 0 && o.CPULimit < time.Second {
+		return fmt.Errorf("dynamic: invalid process cpu limit %v, at least 1s", o.CPULimit)
+	}
+	return nil
+}
+
+// cpuLimitSeconds returns the RLIMIT_CPU of d, rounded up to the second.
+func cpuLimitSeconds(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	return uint64((d + time.Second - 1) / time.Second)
+}
+
+// IsRetryable reports whether err is a transient failure of a process
+// tunnel that may succeed when retried.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrProcessExited)
+}
+
+var socketSeq atomic.Uint64
+
+// ProcessTunnel is a TunnelV2 served by a child process running Serve.
+// The child is started on Init, supervised until Close and stopped on Close.
+type ProcessTunnel struct {
+	path     string
+	opts     ProcessOptions
+	nextID   atomic.Uint64
+	restarts atomic.Int64
+	crashes  atomic.Int64
+	wmu      sync.Mutex
+	w        io.WriteCloser
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	pending  map[uint64]chan *rpcFrame
+	exited   chan struct{}
+	ready    bool
+	closing  bool
+	meta     string
+	assetDir string
+}
+
+func NewProcessTunnel(path string, opts ProcessOptions) *ProcessTunnel {
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = 10 * time.Second
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	return &ProcessTunnel{
+		path: path,
+		opts: opts,
+	}
+}
+
+// Restarts returns how many times the supervisor restarted the child.
+func (p *ProcessTunnel) Restarts() int {
+	return int(p.restarts.Load())
+}
+
+func (p *ProcessTunnel) command() (*exec.Cmd, error) {
+	cmd := exec.Command(p.path)
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if p.opts.MemoryLimit > 0 {
+		cmd.Env = append(cmd.Env, EnvRLimitMemory+"="+strconv.FormatUint(p.opts.MemoryLimit, 10))
+	}
+	if p.opts.CPULimit > 0 {
+		cmd.Env = append(cmd.Env, EnvRLimitCPU+"="+strconv.FormatUint(cpuLimitSeconds(p.opts.CPULimit), 10))
+	}
+	p.mu.Lock()
+	if p.assetDir != "" {
+		cmd.Env = append(cmd.Env, EnvAssetDir+"="+p.assetDir)
+	}
+	p.mu.Unlock()
+	if p.opts.MemoryLimit > 0 || p.opts.CPULimit > 0 {
+		if err := limitCommand(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+func (p *ProcessTunnel) start() error {
+	if err := p.opts.Validate(); err != nil {
+		return err
+	}
+	cmd, err := p.command()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	var w io.WriteCloser
+	switch p.opts.Transport {
+	case ProcessTransportUnix:
+		socketPath := filepath.Join(os.TempDir(), fmt.Sprintf("dynamic-%d-%d.sock", os.Getpid(), socketSeq.Add(1)))
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s, %w", socketPath, err)
+		}
+		defer listener.Close()
+		listener.(*net.UnixListener).SetDeadline(time.Now().Add(p.opts.StartTimeout))
+
+		cmd.Env = append(cmd.Env, EnvRPCSocket+"="+socketPath)
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start process %s, %w", p.path, err)
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("failed to accept process %s, %w", p.path, err)
+		}
+		r, w = conn, conn
+	default:
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start process %s, %w", p.path, err)
+		}
+		r, w = stdout, stdin
+	}
+	log.Printf("[dynamic] started process %s, pid %d", p.path, cmd.Process.Pid)
+
+	p.wmu.Lock()
+	p.w = w
+	p.wmu.Unlock()
+
+	// Close may have run while the child was starting, it must not outlive it.
+	exited := make(chan struct{})
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		w.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return p.errClosed()
+	}
+	p.cmd = cmd
+	p.ready = false
+	p.pending = make(map[uint64]chan *rpcFrame)
+	p.exited = exited
+	p.mu.Unlock()
+
+	go p.read(bufio.NewReader(r), w, cmd, exited)
+
+	return nil
+}
+
+// boot starts the child, initializes its tunnel and checks its health via Meta.
+func (p *ProcessTunnel) boot(ctx context.Context) error {
+	p.mu.Lock()
+	closing := p.closing
+	p.mu.Unlock()
+	if closing {
+		return p.errClosed()
+	}
+	if err := p.start(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.opts.StartTimeout)
+	defer cancel()
+
+	if _, err := p.call(ctx, &rpcFrame{Kind: rpcKindInit}); err != nil {
+		p.kill()
+		return err
+	}
+
+	resp, err := p.call(ctx, &rpcFrame{Kind: rpcKindMeta})
+	if err != nil {
+		p.kill()
+		return fmt.Errorf("dynamic: health check of process %s failed, %w", p.path, err)
+	}
+	p.mu.Lock()
+	p.meta = string(resp.Payload)
+	p.ready = true
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *ProcessTunnel) read(r io.Reader, w io.Closer, cmd *exec.Cmd, exited chan struct{}) {
+	startTime := time.Now()
+	for {
+		resp, err := readRPCFrame(r)
+		if err != nil {
+			break
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+
+	w.Close()
+	err := cmd.Wait()
+	log.Printf("[dynamic] process %s exited: %v", p.path, err)
+
+	p.mu.Lock()
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+	close(exited)
+	// a child that never finished booting is retried by boot's caller.
+	crashed := p.ready && !p.closing
+	p.mu.Unlock()
+
+	if crashed && p.opts.Restart {
+		go p.supervise(time.Since(startTime))
+	}
+}
+
+func (p *ProcessTunnel) errClosed() error {
+	return fmt.Errorf("dynamic: process %s is closed", p.path)
+}
+
+// supervise restarts the crashed child, doubling the backoff while it keeps
+// crashing within MaxBackoff of its start.
+func (p *ProcessTunnel) supervise(uptime time.Duration) {
+	crashes := p.crashes.Add(1)
+	if uptime >= p.opts.MaxBackoff {
+		crashes = 1
+		p.crashes.Store(crashes)
+	}
+	backoff := min(p.opts.MinBackoff<<min(crashes-1, 16), p.opts.MaxBackoff)
+
+	for attempt := 1; ; attempt++ {
+		if p.opts.MaxRestarts > 0 && attempt > p.opts.MaxRestarts {
+			log.Printf("[dynamic] process %s gave up after %d restart attempts", p.path, p.opts.MaxRestarts)
+			return
+		}
+
+		time.Sleep(backoff)
+
+		p.mu.Lock()
+		closing := p.closing
+		p.mu.Unlock()
+		if closing {
+			return
+		}
+
+		log.Printf("[dynamic] restarting process %s, attempt %d", p.path, attempt)
+		if err := p.boot(context.Background()); err != nil {
+			log.Printf("[dynamic] restart process %s failed: %v", p.path, err)
+			backoff = min(backoff*2, p.opts.MaxBackoff)
+			continue
+		}
+		p.restarts.Add(1)
+		return
+	}
+}
+
+func (p *ProcessTunnel) call(ctx context.Context, req *rpcFrame) (*rpcFrame, error) {
+	p.mu.Lock()
+	if p.exited == nil {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s not started", ErrProcessExited, p.path)
+	}
+	select {
+	case <-p.exited:
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrProcessExited, p.path)
+	default:
+	}
+	req.ID = p.nextID.Add(1)
+	ch := make(chan *rpcFrame, 1)
+	p.pending[req.ID] = ch
+	p.mu.Unlock()
+
+	if err := p.write(req); err != nil {
+		p.forget(req.ID)
+		return nil, fmt.Errorf("%w: %s, %v", ErrProcessExited, p.path, err)
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrProcessExited, p.path)
+		}
+		if resp.Error != "" {
+			return resp, &RemoteError{Message: resp.Error}
+		}
+		return resp, nil
+	case <-ctx.Done():
+		p.forget(req.ID)
+		if req.Kind == rpcKindInvoke {
+			p.write(&rpcFrame{ID: req.ID, Kind: rpcKindCancel})
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (p *ProcessTunnel) write(f *rpcFrame) error {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+
+	return writeRPCFrame(p.w, f)
+}
+
+func (p *ProcessTunnel) forget(id uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.pending, id)
+}
+
+func (p *ProcessTunnel) Meta() string {
+	p.mu.Lock()
+	meta := p.meta
+	p.mu.Unlock()
+	if meta != "" {
+		return meta
+	}
+
+	resp, err := p.call(context.Background(), &rpcFrame{Kind: rpcKindMeta})
+	if err != nil {
+		log.Printf("[dynamic] get meta of process %s failed: %v", p.path, err)
+		return ""
+	}
+	return string(resp.Payload)
+}
+
+// Init starts the child, passing it the asset directory of ctx if any.
+func (p *ProcessTunnel) Init(ctx context.Context) error {
+	p.mu.Lock()
+	p.closing = false
+	p.assetDir, _ = AssetDir(ctx)
+	p.mu.Unlock()
+
+	return p.boot(ctx)
+}
+
+func (p *ProcessTunnel) Invoke(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	resp, err := p.call(ctx, &rpcFrame{Kind: rpcKindInvoke, Method: method, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+// Close stops supervision, asks the child to close its tunnel and exit,
+// and kills it if ctx is done first.
+func (p *ProcessTunnel) Close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closing = true
+	exited := p.exited
+	p.mu.Unlock()
+
+	_, err := p.call(ctx, &rpcFrame{Kind: rpcKindClose})
+	if errors.Is(err, ErrProcessExited) {
+		return nil
+	}
+
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		p.kill()
+	}
+	return err
+}
+
+func (p *ProcessTunnel) kill() {
+	p.mu.Lock()
+	cmd, exited := p.cmd, p.exited
+	p.mu.Unlock()
+	if cmd == nil {
+		return
+	}
+
+	cmd.Process.Kill()
+	<-exited
+}
@@ -0,0 +1,119 @@
+package dynamic_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+// testRLimits returns the memory and cpu rlimits of the process, where
+// supported.
+var testRLimits func() [2]uint64
+
+// TestMain lets the test binary serve as a process package when started
+// by a ProcessTunnel.
+func TestMain(m *testing.M) {
+	if os.Getenv("DYNAMIC_TEST_SERVE") == "1" {
+		d := dynamic.NewDispatcher(dynamic.CodecGob)
+		dynamic.Handle(d, "add", func(ctx context.Context, req addReq) (addResp, error) {
+			return addResp{Sum: req.A + req.B}, nil
+		})
+		dynamic.Handle(d, "block", func(ctx context.Context, req struct{}) (struct{}, error) {
+			<-ctx.Done()
+			return struct{}{}, ctx.Err()
+		})
+		dynamic.Handle(d, "exit", func(ctx context.Context, req struct{}) (struct{}, error) {
+			os.Exit(3)
+			return struct{}{}, nil
+		})
+		if testRLimits != nil {
+			dynamic.Handle(d, "rlimits", func(ctx context.Context, req struct{}) ([2]uint64, error) {
+				return testRLimits(), nil
+			})
+		}
+		if os.Getenv("DYNAMIC_TEST_NO_SELF_LIMIT") == "1" {
+			// behave like a child not applying the limits itself in Serve.
+			os.Unsetenv(dynamic.EnvRLimitMemory)
+			os.Unsetenv(dynamic.EnvRLimitCPU)
+		}
+		if err := dynamic.Serve(d); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestProcessTunnel(t *testing.T) {
+	t.Setenv("DYNAMIC_TEST_SERVE", "1")
+
+	for _, transport := range []dynamic.ProcessTransport{dynamic.ProcessTransportStdio, dynamic.ProcessTransportUnix} {
+		p := dynamic.NewProcessTunnel(os.Args[0], dynamic.ProcessOptions{Transport: transport})
+		if err := p.Init(context.Background()); err != nil {
+			t.Fatalf("transport %d: Init err=%v", transport, err)
+		}
+		tunnel := dynamic.AsTunnel(p)
+
+		resp, err := dynamic.Call[addReq, addResp](tunnel, "add", addReq{A: 2, B: 3})
+		if err != nil || resp.Sum != 5 {
+			t.Fatalf("transport %d: Call=%+v,%v want Sum 5", transport, resp, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = p.Invoke(ctx, "block", nil)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("transport %d: block err=%v want context.DeadlineExceeded", transport, err)
+		}
+
+		if err := p.Close(context.Background()); err != nil {
+			t.Fatalf("transport %d: Close err=%v", transport, err)
+		}
+		if _, err := p.Invoke(context.Background(), "add", nil); !errors.Is(err, dynamic.ErrProcessExited) {
+			t.Fatalf("transport %d: Invoke after Close err=%v want ErrProcessExited", transport, err)
+		}
+	}
+}
+
+func TestProcessTunnel_Restart(t *testing.T) {
+	t.Setenv("DYNAMIC_TEST_SERVE", "1")
+
+	p := dynamic.NewProcessTunnel(os.Args[0], dynamic.ProcessOptions{
+		Restart:    true,
+		MinBackoff: 10 * time.Millisecond,
+	})
+	if err := p.Init(context.Background()); err != nil {
+		t.Fatalf("Init err=%v", err)
+	}
+	defer p.Close(context.Background())
+
+	if _, err := p.Invoke(context.Background(), "exit", nil); !dynamic.IsRetryable(err) {
+		t.Fatalf("Invoke crashing the child err=%v want retryable", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Restarts() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("child was not restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := dynamic.Call[addReq, addResp](dynamic.AsTunnel(p), "add", addReq{A: 1, B: 1})
+	if err != nil || resp.Sum != 2 {
+		t.Fatalf("Call after restart=%+v,%v want Sum 2", resp, err)
+	}
+}
+
+func TestProcessOptions_Validate(t *testing.T) {
+	if err := (dynamic.ProcessOptions{CPULimit: 500 * time.Millisecond}).Validate(); err == nil {
+		t.Fatal("Validate of a cpu limit under 1s err=nil")
+	}
+	if err := (dynamic.ProcessOptions{CPULimit: 1500 * time.Millisecond}).Validate(); err != nil {
+		t.Fatalf("Validate err=%v want nil", err)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin
+
+package dynamic_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func init() {
+	testRLimits = func() [2]uint64 {
+		var memory, cpu syscall.Rlimit
+		syscall.Getrlimit(syscall.RLIMIT_AS, &memory)
+		syscall.Getrlimit(syscall.RLIMIT_CPU, &cpu)
+		return [2]uint64{memory.Cur, cpu.Cur}
+	}
+}
+
+func TestProcessTunnel_HostRLimits(t *testing.T) {
+	t.Setenv("DYNAMIC_TEST_SERVE", "1")
+	t.Setenv("DYNAMIC_TEST_NO_SELF_LIMIT", "1")
+
+	p := dynamic.NewProcessTunnel(os.Args[0], dynamic.ProcessOptions{
+		MemoryLimit: 8 << 30,
+		CPULimit:    1500 * time.Millisecond,
+	})
+	if err := p.Init(context.Background()); err != nil {
+		t.Fatalf("Init err=%v", err)
+	}
+	defer p.Close(context.Background())
+
+	limits, err := dynamic.Call[struct{}, [2]uint64](dynamic.AsTunnel(p), "rlimits", struct{}{})
+	if err != nil {
+		t.Fatalf("Call err=%v", err)
+	}
+	if limits != [2]uint64{8 << 30, 2} {
+		t.Fatalf("rlimits=%v want [%d 2]", limits, uint64(8<<30))
+	}
+}
@@ -0,0 +1,176 @@
+package dynamic
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DownloadProgress is the state of the download of a file of a package,
+// reported to DownloadOptions.Progress and by Downloads. Each file of a
+// package is reported on its own, the progress of a package is the sum of
+// those of its Package.
+type DownloadProgress struct {
+	// Package is the DynamicIndex string of the package.
+	Package string
+	// File is the artifact or the archive downloaded.
+	File string
+	// Done is the number of bytes received, Total the size of the object,
+	// -1 if unknown. Compressed objects are counted compressed.
+	Done  int64
+	Total int64
+	// Rate is the average number of bytes received per second.
+	Rate     float64
+	Started  time.Time
+	Finished bool
+	Err      error
+}
+
+// Percent returns the part of the object received, -1 if its size is unknown.
+func (p DownloadProgress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Done) * 100 / float64(p.Total)
+}
+
+func (p DownloadProgress) String() string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("downloading %s %s %d bytes", p.Package, p.File, p.Done)
+	}
+	return fmt.Sprintf("downloading %s %s %.0f%%", p.Package, p.File, p.Percent())
+}
+
+// progressInterval is the minimum interval between two reports of the
+// progress of a download.
+const progressInterval = 500 * time.Millisecond
+
+// downloadTracker accumulates the progress of a download and reports it.
+type downloadTracker struct {
+	mu         sync.Mutex
+	progress   DownloadProgress
+	reported   time.Time
+	report     func(DownloadProgress)
+	onFinished func()
+}
+
+func (t *downloadTracker) add(n int64) {
+	if t == nil || n == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.progress.Done += n
+	t.update()
+	var report bool
+	if now := time.Now(); now.Sub(t.reported) >= progressInterval {
+		t.reported = now
+		report = true
+	}
+	progress := t.progress
+	t.mu.Unlock()
+
+	if report && t.report != nil {
+		t.report(progress)
+	}
+}
+
+func (t *downloadTracker) finish(err error) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.progress.Finished = true
+	t.progress.Err = err
+	t.update()
+	progress := t.progress
+	t.mu.Unlock()
+
+	t.onFinished()
+	if t.report != nil {
+		t.report(progress)
+	}
+}
+
+func (t *downloadTracker) update() {
+	if elapsed := time.Since(t.progress.Started).Seconds(); elapsed > 0 {
+		t.progress.Rate = float64(t.progress.Done) / elapsed
+	}
+}
+
+func (t *downloadTracker) snapshot() DownloadProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.progress
+}
+
+// trackedReader counts the bytes read from r to a tracker.
+type trackedReader struct {
+	r       io.Reader
+	tracker *downloadTracker
+}
+
+func (r trackedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.tracker.add(int64(n))
+	return n, err
+}
+
+// downloadProgress tracks the downloads in flight of a warehouse.
+type downloadProgress struct {
+	mu        sync.Mutex
+	downloads map[*downloadTracker]struct{}
+}
+
+// track starts tracking the download of file of a package, reporting it to
+// report if not nil.
+func (d *downloadProgress) track(pkg string, file string, total int64, report func(DownloadProgress)) *downloadTracker {
+	now := time.Now()
+	t := &downloadTracker{
+		progress: DownloadProgress{
+			Package: pkg,
+			File:    file,
+			Total:   total,
+			Started: now,
+		},
+		reported: now,
+		report:   report,
+	}
+	t.onFinished = func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		delete(d.downloads, t)
+	}
+
+	d.mu.Lock()
+	if d.downloads == nil {
+		d.downloads = make(map[*downloadTracker]struct{})
+	}
+	d.downloads[t] = struct{}{}
+	d.mu.Unlock()
+
+	if report != nil {
+		report(t.progress)
+	}
+	return t
+}
+
+// list returns the progress of the downloads in flight, oldest first.
+func (d *downloadProgress) list() []DownloadProgress {
+	d.mu.Lock()
+	list := make([]DownloadProgress, 0, len(d.downloads))
+	for t := range d.downloads {
+		list = append(list, t.snapshot())
+	}
+	d.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Started.Before(list[j].Started)
+	})
+	return list
+}
@@ -0,0 +1,58 @@
+package dynamic_test
+
+import (
+	"sync"
+	"testing"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func TestDownloadProgress(t *testing.T) {
+	s := newFakeS3(t)
+	useFakeS3(t, s, testDownloadToolchain)
+
+	var mu sync.Mutex
+	var reports []dynamic.DownloadProgress
+	useDownloadOptions(t, dynamic.DownloadOptions{Progress: func(p dynamic.DownloadProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		reports = append(reports, p)
+	}})
+
+	data := []byte("binary")
+	putProcessPackage(s, "progress", data)
+	if err := prefetchV1("progress"); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(reports) < 2 {
+		t.Fatalf("reports=%+v want a start and a finish", reports)
+	}
+	first, last := reports[0], reports[len(reports)-1]
+	if first.Finished || first.Done != 0 {
+		t.Fatalf("first report=%+v want nothing done", first)
+	}
+	// the progress is reported per file, the package is only named.
+	if last.Package != "default_progress_v1" || last.File != "bin_default_progress_v1" {
+		t.Fatalf("last report of %s %s want default_progress_v1 bin_default_progress_v1", last.Package, last.File)
+	}
+	if !last.Finished || last.Err != nil || last.Done != int64(len(data)) || last.Total != int64(len(data)) || last.Percent() != 100 {
+		t.Fatalf("last report=%+v want %d bytes done", last, len(data))
+	}
+	if downloads := dynamic.Downloads(); len(downloads) != 0 {
+		t.Fatalf("Downloads=%+v after the downloads finished", downloads)
+	}
+}
+
+func TestDownloadProgress_Percent(t *testing.T) {
+	if p := (dynamic.DownloadProgress{Done: 10, Total: -1}); p.Percent() != -1 {
+		t.Fatalf("Percent of an unknown size=%v want -1", p.Percent())
+	}
+	if p := (dynamic.DownloadProgress{Done: 25, Total: 100}); p.Percent() != 25 {
+		t.Fatalf("Percent=%v want 25", p.Percent())
+	}
+}
@@ -8,7 +8,10 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +31,14 @@ type Remote interface {
 	Path() string
 }
 
+// RemoteV2 is a Remote downloading a package in a given mode until ctx is
+// done, it returns ErrTunnelNotExits when it doesn't have the package. The
+// warehouse detects it by type assertion, other remotes are asked to Sync.
+type RemoteV2 interface {
+	Remote
+	SyncMode(ctx context.Context, name string, mode PackageMode) error
+}
+
 func NewRemote(remotePath string) Remote {
 	if remotePath == "" {
 		return nil
@@ -40,7 +51,11 @@ func NewRemote(remotePath string) Remote {
 
 	switch u.Scheme {
 	case "s3":
-		return NewS3Remote(u.Host)
+		r := NewS3Remote(u.Host)
+		// an S3 compatible store, e.g. s3://bucket?endpoint=http://minio:9000,
+		// is addressed path-style at its endpoint.
+		r.endpoint = u.Query().Get("endpoint")
+		return r
 	default:
 		log.Panicf("[dynamic] unknown remote scheme: %s", u.Scheme)
 	}
@@ -49,7 +64,10 @@ func NewRemote(remotePath string) Remote {
 }
 
 type S3Remote struct {
-	bucket string
+	bucket   string
+	endpoint string
+	mu       sync.Mutex
+	client   *s3.Client
 }
 
 func NewS3Remote(bucket string) *S3Remote {
@@ -62,73 +80,242 @@ func (r *S3Remote) Path() string {
 	return fmt.Sprintf("s3://%s", r.bucket)
 }
 
-func (r *S3Remote) createS3Client() (*s3.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background())
+// createS3Client returns the client of the bucket, created once and then
+// shared by the syncs, along with its connections.
+func (r *S3Remote) createS3Client(ctx context.Context) (*s3.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client != nil {
+		return r.client, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client, %w", err)
 	}
 
-	return s3.NewFromConfig(cfg), nil
+	r.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if r.endpoint != "" {
+			o.BaseEndpoint = aws.String(r.endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return r.client, nil
+}
+
+// objectOpenerOfS3 opens ranges of an object of the bucket.
+func (r *S3Remote) objectOpenerOfS3(client *s3.Client, remoteFilePath string) objectOpener {
+	return func(ctx context.Context, offset int64, end int64, etag string) (io.ReadCloser, string, int64, error) {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(r.bucket),
+			Key:    aws.String(remoteFilePath),
+		}
+		if end >= 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, end-1))
+		} else if offset > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+		}
+		if etag != "" {
+			input.IfMatch = aws.String(etag)
+		}
+		// the requests are retried by resumableObject, not by the client.
+		getObjectResponse, err := client.GetObject(ctx, input, func(o *s3.Options) {
+			o.RetryMaxAttempts = 1
+		})
+		if err != nil {
+			return nil, "", 0, err
+		}
+		size := int64(-1)
+		if getObjectResponse.ContentRange != nil {
+			// bytes <first>-<last>/<size>
+			if _, total, ok := strings.Cut(*getObjectResponse.ContentRange, "/"); ok {
+				if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+					size = n
+				}
+			}
+		} else if getObjectResponse.ContentLength != nil {
+			size = *getObjectResponse.ContentLength
+		}
+		return getObjectResponse.Body, aws.ToString(getObjectResponse.ETag), size, nil
+	}
+}
+
+// getObjectFromS3 opens an object of the bucket, retrying transient errors
+// and resuming where it stopped from byte ranges while its ETag is unchanged.
+func (r *S3Remote) getObjectFromS3(ctx context.Context, client *s3.Client, remoteFilePath string) (*resumableObject, error) {
+	return openResumable(ctx, remoteFilePath, r.objectOpenerOfS3(client, remoteFilePath), warehouse.DownloadOptions(), warehouse.downloadLimiter())
 }
 
-func (r *S3Remote) downloadFileFromS3(remoteFilePath string, localFilePath string) error {
-	client, err := r.createS3Client()
+// downloadManifestFromS3 returns the manifest of a package, or the legacy
+// one of mode if it has none.
+func (r *S3Remote) downloadManifestFromS3(ctx context.Context, name string, mode PackageMode, toolchainDir string) (*Manifest, []byte, error) {
+	client, err := r.createS3Client(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create s3 client, %w", err)
+		return nil, nil, fmt.Errorf("failed to create s3 client, %w", err)
 	}
 
-	// Create a file to write the S3 Object contents to.
-	getObjectResponse, err := client.GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: aws.String(r.bucket),
-		Key:    aws.String(remoteFilePath),
-	})
+	remoteFilePath := filepath.ToSlash(filepath.Join(toolchainDir, name, ManifestFileName))
+	object, err := r.getObjectFromS3(ctx, client, remoteFilePath)
 	if err != nil {
-		log.Printf("[dynamic] failed to get object, %v", err)
-		return ErrTunnelNotExits
+		if !isMissingObject(err) {
+			return nil, nil, err
+		}
+		log.Printf("[dynamic] %s has no manifest, using legacy artifacts: %v", filepath.Join(r.bucket, remoteFilePath), err)
+		return DefaultManifest(name, mode), nil, nil
 	}
+	defer object.Close()
 
-	file, err := os.Create(localFilePath)
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest, %w", err)
+	}
+	m, err := ParseManifest(data)
 	if err != nil {
-		return fmt.Errorf("failed to create file %q, %w", localFilePath, err)
+		return nil, nil, err
+	}
+	return m, data, nil
+}
+
+// downloadObjectFromS3 downloads an object of the bucket into partialPath,
+// resuming from the bytes already there, see downloadObject.
+func (r *S3Remote) downloadObjectFromS3(ctx context.Context, client *s3.Client, name string, file string, remoteFilePath string, partialPath string) error {
+	if err := os.MkdirAll(filepath.Dir(partialPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create dir %s, %w", filepath.Dir(partialPath), err)
+	}
+	return downloadObject(ctx, remoteFilePath, r.objectOpenerOfS3(client, remoteFilePath), warehouse.DownloadOptions(), warehouse.downloadLimiter(), partialPath, func(total int64) *downloadTracker {
+		return warehouse.trackDownload(name, file, total)
+	})
+}
+
+// downloadFileFromS3 downloads the object of an artifact in the first of
+// encodings published next to localFilePath, see downloadEncodedFromS3.
+func (r *S3Remote) downloadFileFromS3(ctx context.Context, name string, remoteFilePath string, localFilePath string, artifact Artifact, encodings []string) error {
+	var err error
+	for _, encoding := range encodings {
+		err = r.downloadEncodedFromS3(ctx, name, remoteFilePath, localFilePath, artifact, encoding)
+		if !isMissingObject(err) {
+			return err
+		}
 	}
-	defer file.Close()
+	return err
+}
 
-	written, err := io.Copy(file, getObjectResponse.Body)
+// downloadEncodedFromS3 downloads the object of an artifact in encoding
+// next to localFilePath, decompresses it into a temp file while verifying
+// it if encoded, and only then moves it in place. An interrupted download
+// is resumed by the next one.
+func (r *S3Remote) downloadEncodedFromS3(ctx context.Context, name string, remoteFilePath string, localFilePath string, artifact Artifact, encoding string) error {
+	client, err := r.createS3Client(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to write file contents! %w", err)
-	} else if written != *getObjectResponse.ContentLength {
-		return fmt.Errorf("wrote a different size than was given to us")
+		return fmt.Errorf("failed to create s3 client, %w", err)
+	}
+
+	suffix := encodingSuffixes[encoding]
+	partialPath := localFilePath + suffix + partialSuffix
+	if err := r.downloadObjectFromS3(ctx, client, name, artifact.File+suffix, remoteFilePath+suffix, partialPath); err != nil {
+		return err
+	}
+
+	tempFilePath := partialPath
+	if encoding != "" {
+		log.Printf("[dynamic] decompressing %s from %s", localFilePath, encoding)
+		tempFilePath = localFilePath + ".decode"
+		defer os.Remove(tempFilePath)
+		if err := decompressVerified(artifact, encoding, partialPath, tempFilePath); err != nil {
+			removePartial(partialPath)
+			return err
+		}
+	} else if err := artifact.Verify(tempFilePath); err != nil {
+		removePartial(partialPath)
+		return err
 	}
 
 	// Ensure the downloaded .so file has execution permissions.
 	// plugin.Open requires the file to be readable and sometimes executable depending on the OS/Filesystem.
-	if err := os.Chmod(localFilePath, 0755); err != nil {
-		return fmt.Errorf("failed to chmod file %q, %w", localFilePath, err)
+	if err := os.Chmod(tempFilePath, 0755); err != nil {
+		return fmt.Errorf("failed to chmod file %q, %w", tempFilePath, err)
 	}
 
+	if err := os.Rename(tempFilePath, localFilePath); err != nil {
+		return fmt.Errorf("failed to rename file %q, %w", tempFilePath, err)
+	}
+	removePartial(partialPath)
+
 	return nil
 }
 
-func (r *S3Remote) batchDownloadFilesFromS3(name string) error {
-	files := []string{
-		fmt.Sprintf("libcgo_%s.so", name),
-		fmt.Sprintf("libgo_%s.so", name),
+// artifactEncodings returns the encodings to download the objects of the
+// artifacts of m in, best first. A manifest records the encoding of each
+// artifact. The objects of a package without manifest are listed to find
+// the zstd or gzip one first, or else probed in each encoding in turn.
+func (r *S3Remote) artifactEncodings(ctx context.Context, client *s3.Client, name string, toolchainDir string, m *Manifest, legacy bool) map[string][]string {
+	encodings := make(map[string][]string, len(m.Artifacts))
+	for _, artifact := range m.Artifacts {
+		encodings[artifact.File] = []string{artifact.Encoding}
+	}
+	if !legacy {
+		return encodings
+	}
+
+	objects, err := r.objectsInS3(ctx, client, path.Join(toolchainDir, name)+"/")
+	if err != nil {
+		log.Printf("[dynamic] listing s3://%s failed, probing compressed objects: %v", path.Join(r.bucket, toolchainDir, name), err)
+	}
+	for _, artifact := range m.Artifacts {
+		if err != nil {
+			encodings[artifact.File] = legacyEncodings
+			continue
+		}
+		for _, encoding := range legacyEncodings {
+			if encoding == "" || objects[artifact.File+encodingSuffixes[encoding]] {
+				encodings[artifact.File] = []string{encoding}
+				break
+			}
+		}
+	}
+	return encodings
+}
+
+// objectsInS3 lists the objects under prefix, relative to it.
+func (r *S3Remote) objectsInS3(ctx context.Context, client *s3.Client, prefix string) (map[string]bool, error) {
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucket),
+		Prefix: aws.String(prefix),
+	})
+	objects := make(map[string]bool)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, classifyRemoteError(err)
+		}
+		for _, o := range page.Contents {
+			objects[strings.TrimPrefix(aws.ToString(o.Key), prefix)] = true
+		}
 	}
+	return objects, nil
+}
 
+func (r *S3Remote) batchDownloadFilesFromS3(ctx context.Context, name string, toolchainDir string, m *Manifest, encodings map[string][]string) error {
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(files))
-	for _, file := range files {
+	errChan := make(chan error, len(m.Artifacts))
+	for _, artifact := range m.Artifacts {
 		wg.Add(1)
-		go func(file string) {
+		go func(artifact Artifact) {
 			defer wg.Done()
 
-			localFilePath := filepath.Join(filepath.Join(warehouse.Local.Path(), toolchain.String(), name), file)
-			remoteFilePath := filepath.ToSlash(filepath.Join(toolchain.String(), name, file))
+			localFilePath := filepath.Join(warehouse.Local.DirOf(toolchainDir, name), artifact.File)
+			remoteFilePath := filepath.ToSlash(filepath.Join(toolchainDir, name, artifact.File))
 
-			if stat, err := os.Stat(localFilePath); err != nil {
+			downloaded := true
+			if _, err := os.Stat(localFilePath); err != nil {
 				if os.IsNotExist(err) {
 					log.Printf("[dynamic] %s not found, downloading from s3://%s...", localFilePath, filepath.Join(r.bucket, remoteFilePath))
-					if err := r.downloadFileFromS3(remoteFilePath, localFilePath); err != nil {
+					if err := r.downloadFileFromS3(ctx, name, remoteFilePath, localFilePath, artifact, encodings[artifact.File]); err != nil {
+						if artifact.Optional && isMissingObject(err) {
+							log.Printf("[dynamic] optional %s not found in s3, skipped", remoteFilePath)
+							return
+						}
 						log.Printf("[dynamic] failed to download file from s3, %v", err)
 						errChan <- err
 						return
@@ -138,40 +325,219 @@ func (r *S3Remote) batchDownloadFilesFromS3(name string) error {
 					errChan <- err
 					return
 				}
-			} else if stat.Size() == 0 {
-				log.Printf("[dynamic] %s is empty, downloading from s3://%s...", localFilePath, filepath.Join(r.bucket, remoteFilePath))
-				if err := os.Remove(localFilePath); err != nil {
-					log.Printf("[dynamic] failed to remove file, %v", err)
-					errChan <- err
-					return
-				}
-				if err := r.downloadFileFromS3(remoteFilePath, localFilePath); err != nil {
+			} else if err := artifact.Verify(localFilePath); err != nil {
+				log.Printf("[dynamic] %s is invalid (%v), downloading from s3://%s...", localFilePath, err, filepath.Join(r.bucket, remoteFilePath))
+				if err := r.downloadFileFromS3(ctx, name, remoteFilePath, localFilePath, artifact, encodings[artifact.File]); err != nil {
 					log.Printf("[dynamic] failed to download file from s3, %v", err)
 					errChan <- err
 					return
 				}
 			} else {
 				log.Printf("[dynamic] %s is already exists", localFilePath)
+				downloaded = false
+			}
+
+			if artifact.Kind == ArtifactAssets {
+				assetsDir := filepath.Join(warehouse.Local.DirOf(toolchainDir, name), AssetsDirName)
+				if _, err := os.Stat(assetsDir); downloaded || err != nil {
+					if err := warehouse.Local.UnpackAssets(toolchainDir, name, artifact); err != nil {
+						log.Printf("[dynamic] failed to unpack assets, %v", err)
+						errChan <- err
+						return
+					}
+				}
 			}
-		}(file)
+		}(artifact)
 	}
 	wg.Wait()
+	close(errChan)
 
 	if len(errChan) > 0 {
 		log.Printf("[dynamic] %d errors occurred during downloading", len(errChan))
+		var errs []error
 		for err := range errChan {
 			if isTunnelNotExist(err) {
 				return ErrTunnelNotExits
 			}
+			errs = append(errs, err)
 		}
-		return errors.New("dynamic: download failed")
+		return fmt.Errorf("dynamic: download failed, %w", errs[0])
 	}
 
 	return nil
 }
 
+// remoteLayout is how a package is published in a toolchain directory.
+type remoteLayout int
+
+const (
+	// layoutUnknown is probed by downloading the archive and then the
+	// manifest, when the remote can't be listed.
+	layoutUnknown remoteLayout = iota
+	layoutMissing
+	layoutArchive
+	layoutFiles
+)
+
+// Sync downloads a package in the mode set by UsePackageMode.
 func (r *S3Remote) Sync(name string) error {
-	dir := filepath.Join(warehouse.Local.Path(), toolchain.String(), name)
+	return r.SyncMode(context.Background(), name, warehouse.Mode(name))
+}
+
+// SyncMode downloads a package from the first compatible toolchain directory
+// that has it. The toolchain directories of the bucket are listed once, and
+// only the compatible ones published are probed, each with a single list
+// request. The first one holding the package is the one synced as it is
+// published there, the others are not tried. Without the permission to
+// list the bucket, each directory is probed by downloading from it.
+func (r *S3Remote) SyncMode(ctx context.Context, name string, mode PackageMode) error {
+	client, err := r.createS3Client(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create s3 client, %w", err)
+	}
+
+	toolchainDirs := ToolchainDirs(mode)
+	listable := true
+	published, err := r.toolchainDirsInS3(ctx, client)
+	if errors.Is(err, ErrRemoteAuth) {
+		log.Printf("[dynamic] listing s3://%s denied, probing by downloading: %v", r.bucket, err)
+		listable = false
+	} else if err != nil {
+		return fmt.Errorf("failed to list s3, %w", err)
+	} else {
+		var found []string
+		for _, toolchainDir := range toolchainDirs {
+			if published[toolchainDir] {
+				found = append(found, toolchainDir)
+			}
+		}
+		toolchainDirs = found
+	}
+
+	var denied error
+	for _, toolchainDir := range toolchainDirs {
+		layout := layoutUnknown
+		if listable {
+			layout, err = r.layoutInS3(ctx, client, name, toolchainDir)
+			if errors.Is(err, ErrRemoteAuth) {
+				log.Printf("[dynamic] listing s3://%s denied, probing by downloading: %v", r.bucket, err)
+				listable = false
+			} else if err != nil {
+				return fmt.Errorf("failed to list s3, %w", err)
+			}
+		}
+
+		switch layout {
+		case layoutMissing:
+		case layoutUnknown:
+			err := r.syncFrom(ctx, name, mode, toolchainDir, layout)
+			if err == nil {
+				return nil
+			}
+			if !isMissingObject(err) {
+				return err
+			}
+			if !isTunnelNotExist(err) {
+				denied = err
+			}
+		default:
+			return r.syncFrom(ctx, name, mode, toolchainDir, layout)
+		}
+		log.Printf("[dynamic] package %s not found in s3://%s", name, filepath.ToSlash(filepath.Join(r.bucket, toolchainDir, name)))
+	}
+	if denied != nil {
+		// the package may as well be there, but can't be read.
+		return fmt.Errorf("%w, %w", ErrTunnelNotExits, denied)
+	}
+	return ErrTunnelNotExits
+}
+
+// toolchainDirsInS3 lists the toolchain directories at the root of the bucket.
+func (r *S3Remote) toolchainDirsInS3(ctx context.Context, client *s3.Client) (map[string]bool, error) {
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(r.bucket),
+		Delimiter: aws.String("/"),
+	})
+	dirs := make(map[string]bool)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, classifyRemoteError(err)
+		}
+		for _, p := range page.CommonPrefixes {
+			dirs[strings.TrimSuffix(aws.ToString(p.Prefix), "/")] = true
+		}
+	}
+	return dirs, nil
+}
+
+// layoutInS3 tells how toolchainDir holds a package, as an archive or as a
+// directory, with a single list request. The archive wins over the
+// directory when both are published.
+func (r *S3Remote) layoutInS3(ctx context.Context, client *s3.Client, name string, toolchainDir string) (remoteLayout, error) {
+	prefix := path.Join(toolchainDir, name)
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(r.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	layout := layoutMissing
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return layoutUnknown, classifyRemoteError(err)
+		}
+		// other packages may share the prefix, e.g. pkg_v1 and pkg_v10.
+		for _, o := range page.Contents {
+			if aws.ToString(o.Key) == prefix+ArchiveSuffix {
+				return layoutArchive, nil
+			}
+		}
+		for _, p := range page.CommonPrefixes {
+			if aws.ToString(p.Prefix) == prefix+"/" {
+				layout = layoutFiles
+			}
+		}
+	}
+	return layout, nil
+}
+
+// syncArchiveFrom downloads the archive of a package and unpacks it.
+func (r *S3Remote) syncArchiveFrom(ctx context.Context, name string, mode PackageMode, toolchainDir string) error {
+	client, err := r.createS3Client(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create s3 client, %w", err)
+	}
+
+	remoteFilePath := filepath.ToSlash(filepath.Join(toolchainDir, name+ArchiveSuffix))
+	partialPath := warehouse.Local.ArchivePath(toolchainDir, name) + partialSuffix
+	log.Printf("[dynamic] downloading archive from s3://%s...", filepath.Join(r.bucket, remoteFilePath))
+
+	startTime := time.Now()
+	if err := r.downloadObjectFromS3(ctx, client, name, name+ArchiveSuffix, remoteFilePath, partialPath); err != nil {
+		return err
+	}
+	log.Printf("[dynamic] download archive from s3 took %v", time.Since(startTime))
+
+	// an archive failing to unpack is downloaded again.
+	defer removePartial(partialPath)
+	return warehouse.Local.UnpackArchive(toolchainDir, name, mode, partialPath, warehouse.ArchiveKeys()...)
+}
+
+// syncFrom downloads a package from toolchainDir as published in layout,
+// an unknown layout is tried as an archive and then as loose files.
+func (r *S3Remote) syncFrom(ctx context.Context, name string, mode PackageMode, toolchainDir string, layout remoteLayout) error {
+	if layout == layoutArchive || layout == layoutUnknown {
+		err := r.syncArchiveFrom(ctx, name, mode, toolchainDir)
+		if err == nil {
+			return nil
+		}
+		if layout == layoutArchive || !isMissingObject(err) {
+			return fmt.Errorf("failed to sync archive from s3, %w", err)
+		}
+	}
+
+	dir := warehouse.Local.DirOf(toolchainDir, name)
 	if _, err := os.Stat(dir); err != nil {
 		if os.IsNotExist(err) {
 			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
@@ -182,9 +548,21 @@ func (r *S3Remote) Sync(name string) error {
 		}
 	}
 
+	// the partial downloads are kept for the next sync to resume, only an
+	// empty directory is removed.
 	startTime := time.Now()
-	if err := r.batchDownloadFilesFromS3(name); err != nil {
-		os.RemoveAll(dir)
+	m, data, err := r.downloadManifestFromS3(ctx, name, mode, toolchainDir)
+	if err != nil {
+		os.Remove(dir)
+		return fmt.Errorf("failed to download manifest from s3, %w", err)
+	}
+	client, err := r.createS3Client(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create s3 client, %w", err)
+	}
+	encodings := r.artifactEncodings(ctx, client, name, toolchainDir, m, data == nil)
+	if err := r.batchDownloadFilesFromS3(ctx, name, toolchainDir, m, encodings); err != nil {
+		os.Remove(dir)
 		if isTunnelNotExist(err) {
 			return ErrTunnelNotExits
 		}
@@ -192,5 +570,13 @@ func (r *S3Remote) Sync(name string) error {
 	}
 	log.Printf("[dynamic] download files from s3 took %v", time.Since(startTime))
 
+	// the manifest is written last, a package is only described by it once
+	// every artifact is in place.
+	if data != nil {
+		if err := os.WriteFile(filepath.Join(dir, ManifestFileName), data, 0644); err != nil {
+			return fmt.Errorf("failed to write manifest, %w", err)
+		}
+	}
+
 	return nil
 }
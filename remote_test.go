@@ -0,0 +1,467 @@
+package dynamic_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+	"github.com/klauspost/compress/zstd"
+)
+
+// fakeS3 serves the objects of a single bucket path-style, as the S3
+// client of the remote requests them.
+type fakeS3 struct {
+	*httptest.Server
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests []string
+	failures map[string][]fakeFailure
+	// denyMissing answers 403 for missing keys, as S3 does to callers not
+	// allowed to list the bucket.
+	denyMissing bool
+	// delay holds each object request for a time.Duration, which counts in
+	// inFlight meanwhile.
+	delay       atomic.Int64
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+// fakeFailure fails a request with status and code, or after sending
+// truncate bytes of the object if set.
+type fakeFailure struct {
+	status   int
+	code     string
+	truncate int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s := &fakeS3{objects: make(map[string][]byte), failures: make(map[string][]fakeFailure)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeS3) Put(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = data
+}
+
+// Fail makes the next n requests of key, or of the listing if key is
+// empty, fail with status and code.
+func (s *fakeS3) Fail(key string, n int, status int, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures[key] = append(s.failures[key], fakeFailure{status: status, code: code})
+	}
+}
+
+// Truncate makes the next download of key break after at bytes.
+func (s *fakeS3) Truncate(key string, at int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[key] = append(s.failures[key], fakeFailure{truncate: at})
+}
+
+// Requests returns the requests served so far, e.g. "GET key",
+// "GET key bytes=0-9" or "LIST prefix".
+func (s *fakeS3) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+	if key != "" {
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for max := s.maxInFlight.Load(); n > max && !s.maxInFlight.CompareAndSwap(max, n); max = s.maxInFlight.Load() {
+		}
+		time.Sleep(time.Duration(s.delay.Load()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failure fakeFailure
+	if failures := s.failures[key]; len(failures) > 0 {
+		failure, s.failures[key] = failures[0], failures[1:]
+	}
+	if failure.status != 0 {
+		s.requests = append(s.requests, r.Method+" "+key+" failed")
+		writeS3Error(w, failure.status, failure.code)
+		return
+	}
+
+	if key == "" && r.URL.Query().Get("list-type") == "2" {
+		s.requests = append(s.requests, "LIST "+r.URL.Query().Get("prefix"))
+		s.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+		return
+	}
+	if rng := r.Header.Get("Range"); rng != "" {
+		s.requests = append(s.requests, r.Method+" "+key+" "+rng)
+	} else {
+		s.requests = append(s.requests, r.Method+" "+key)
+	}
+
+	data, ok := s.objects[key]
+	if !ok && s.denyMissing {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	} else if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	sum := md5.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if m := r.Header.Get("If-Match"); m != "" && m != etag {
+		writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	first, last := 0, len(data)-1
+	if rng := r.Header.Get("Range"); rng != "" {
+		from, to, _ := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+		first, _ = strconv.Atoi(from)
+		if to != "" {
+			last, _ = strconv.Atoi(to)
+		}
+		if first >= len(data) {
+			writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		last = min(last, len(data)-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+		w.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	}
+	if failure.truncate > 0 {
+		w.Write(data[first : first+failure.truncate])
+		// breaks the connection before the announced length, once the
+		// bytes are sent so the client doesn't retry on its own.
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.Write(data[first : last+1])
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, prefix string, delimiter string) {
+	type content struct {
+		Key  string
+		Size int
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	result := struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		Delimiter      string
+		IsTruncated    bool
+		Contents       []content
+		CommonPrefixes []commonPrefix
+	}{Name: "bucket", Prefix: prefix, Delimiter: delimiter}
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	seen := map[string]bool{}
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			if p := prefix + rest[:i+1]; !seen[p] {
+				seen[p] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{p})
+			}
+			continue
+		}
+		result.Contents = append(result.Contents, content{key, len(s.objects[key])})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// useFakeS3 syncs the warehouse from s into a new local directory, with
+// the toolchain set to info, until the test ends.
+func useFakeS3(t *testing.T, s *fakeS3, info dynamic.ToolchainInfo) string {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	previous := dynamic.CurrentToolchain()
+	dynamic.UseToolchain(info)
+	local := t.TempDir()
+	dynamic.UseWarehouse(local, "s3://bucket?endpoint="+s.URL)
+	t.Cleanup(func() {
+		dynamic.UseWarehouse(local, "")
+		dynamic.UseToolchain(previous)
+	})
+	return local
+}
+
+func TestS3Remote_SyncStopsAtFirstDirectory(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, dynamic.ToolchainInfo{OS: "alpine3.19", Arch: "amd64v2", Compiler: "go1.24.0", Variant: "generic"})
+	dynamic.UsePackageMode("synced", dynamic.PackageModeProcess)
+
+	// default_synced_v10 is another package sharing the prefix.
+	s.Put("alpine3.19_amd64v2_go1.24.0_generic/default_synced_v10/bin_default_synced_v10", []byte("other"))
+	s.Put("alpine3_amd64v2_go1.24.0_generic/default_synced_v1/bin_default_synced_v1", []byte("binary"))
+	s.Put("alpine3_amd64v1_go1.24.0_generic/default_synced_v1/bin_default_synced_v1", []byte("older"))
+
+	if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{{Package: "synced", Version: "v1"}}); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+
+	dir, ok := dynamic.MatchedToolchain("synced", "v1")
+	if want := "alpine3_amd64v2_go1.24.0_generic"; !ok || dir != want {
+		t.Fatalf("MatchedToolchain=%q,%v want %q", dir, ok, want)
+	}
+	data, err := os.ReadFile(filepath.Join(local, dir, "default_synced_v1", "bin_default_synced_v1"))
+	if err != nil || string(data) != "binary" {
+		t.Fatalf("synced file=%q,%v want %q", data, err, "binary")
+	}
+
+	// the bucket root is listed once, and only the published directories
+	// compatible with the toolchain are probed.
+	requests := s.Requests()
+	want := []string{"LIST ", "LIST alpine3.19_amd64v2_go1.24.0_generic/default_synced_v1", "LIST alpine3_amd64v2_go1.24.0_generic/default_synced_v1"}
+	if len(requests) < len(want) || !reflect.DeepEqual(requests[:len(want)], want) {
+		t.Fatalf("requests=%q want the lists %q first", requests, want)
+	}
+	for _, req := range requests[len(want):] {
+		if !strings.Contains(req, "alpine3_amd64v2_go1.24.0_generic/") {
+			t.Fatalf("request %q outside of the matched directory, requests: %q", req, requests)
+		}
+	}
+}
+
+func TestS3Remote_SyncEncodedArtifacts(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, dynamic.ToolchainInfo{OS: "linux", Arch: "amd64v1", Compiler: "go1.24.0", Variant: "generic"})
+	dynamic.UsePackageMode("encoded", dynamic.PackageModeProcess)
+	dynamic.UsePackageMode("corrupted", dynamic.PackageModeProcess)
+
+	binary := bytes.Repeat([]byte("binary"), 1000)
+	data := bytes.Repeat([]byte("data"), 1000)
+	publish := func(name string, sum []byte) {
+		dir := "linux_amd64v1_go1.24.0_generic/" + name
+		manifest, _ := json.Marshal(dynamic.Manifest{Artifacts: []dynamic.Artifact{
+			{File: "bin_" + name, Kind: dynamic.ArtifactProcess, Size: int64(len(binary)), SHA256: hex.EncodeToString(sum), Encoding: dynamic.EncodingZstd},
+			{File: "data.txt", Kind: dynamic.ArtifactData, Encoding: dynamic.EncodingGzip},
+		}})
+		s.Put(dir+"/manifest.json", manifest)
+		s.Put(dir+"/bin_"+name+".zst", zstdOf(t, binary))
+		s.Put(dir+"/data.txt.gz", gzipOf(t, data))
+	}
+	sum := sha256.Sum256(binary)
+	publish("default_encoded_v1", sum[:])
+	publish("default_corrupted_v1", make([]byte, sha256.Size))
+
+	if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{{Package: "encoded", Version: "v1"}}); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+	dir := filepath.Join(local, "linux_amd64v1_go1.24.0_generic", "default_encoded_v1")
+	if got, err := os.ReadFile(filepath.Join(dir, "bin_default_encoded_v1")); err != nil || !bytes.Equal(got, binary) {
+		t.Fatalf("decompressed zstd artifact=%d bytes,%v want %d bytes", len(got), err, len(binary))
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "data.txt")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("decompressed gzip artifact=%d bytes,%v want %d bytes", len(got), err, len(data))
+	}
+	for _, req := range s.Requests() {
+		if strings.HasSuffix(req, "/bin_default_encoded_v1") || strings.HasSuffix(req, "/data.txt") {
+			t.Fatalf("requested the raw object of an encoded artifact: %q", req)
+		}
+	}
+
+	// the checksum is the one of the decompressed file.
+	err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{{Package: "corrupted", Version: "v1"}})
+	if err == nil || !strings.Contains(err.Error(), "sha256") {
+		t.Fatalf("Prefetch of a corrupted artifact err=%v want a sha256 mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(local, "linux_amd64v1_go1.24.0_generic", "default_corrupted_v1", "bin_default_corrupted_v1")); !os.IsNotExist(err) {
+		t.Fatalf("corrupted artifact left in place, stat err=%v", err)
+	}
+}
+
+func TestS3Remote_SyncLegacyCompressed(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, dynamic.ToolchainInfo{OS: "linux", Arch: "amd64v1", Compiler: "go1.24.0", Variant: "generic"})
+	for _, pkg := range []string{"legacyzst", "legacyraw", "legacygz"} {
+		dynamic.UsePackageMode(pkg, dynamic.PackageModeProcess)
+	}
+
+	binary := bytes.Repeat([]byte("binary"), 1000)
+	dir := "linux_amd64v1_go1.24.0_generic/"
+	s.Put(dir+"default_legacyzst_v1/bin_default_legacyzst_v1.zst", zstdOf(t, binary))
+	s.Put(dir+"default_legacyzst_v1/bin_default_legacyzst_v1", []byte("raw"))
+	s.Put(dir+"default_legacyraw_v1/bin_default_legacyraw_v1", binary)
+	s.Put(dir+"default_legacygz_v1/bin_default_legacygz_v1.gz", gzipOf(t, binary))
+
+	prefetch := func(pkg string) {
+		t.Helper()
+		if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{{Package: pkg, Version: "v1"}}); err != nil {
+			t.Fatalf("Prefetch %s err=%v", pkg, err)
+		}
+		file := filepath.Join(local, dir, "default_"+pkg+"_v1", "bin_default_"+pkg+"_v1")
+		if got, err := os.ReadFile(file); err != nil || !bytes.Equal(got, binary) {
+			t.Fatalf("artifact of %s=%d bytes,%v want %d bytes", pkg, len(got), err, len(binary))
+		}
+	}
+
+	// the compressed object is preferred over the raw one.
+	prefetch("legacyzst")
+	for _, req := range s.Requests() {
+		if strings.HasSuffix(req, "/bin_default_legacyzst_v1 bytes=0-16777215") {
+			t.Fatalf("requested the raw object of a compressed artifact, requests: %q", s.Requests())
+		}
+	}
+
+	prefetch("legacyraw")
+
+	// without the permission to list, the objects are probed in turn.
+	s.Fail("", 2, http.StatusForbidden, "AccessDenied")
+	prefetch("legacygz")
+	var probes []string
+	for _, req := range s.Requests() {
+		if strings.Contains(req, "/bin_default_legacygz_v1") {
+			probes = append(probes, req)
+		}
+	}
+	want := []string{
+		"GET " + dir + "default_legacygz_v1/bin_default_legacygz_v1.zst bytes=0-16777215",
+		"GET " + dir + "default_legacygz_v1/bin_default_legacygz_v1.gz bytes=0-16777215",
+	}
+	if !reflect.DeepEqual(probes, want) {
+		t.Fatalf("probes=%q want %q", probes, want)
+	}
+}
+
+func zstdOf(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	w, err := zstd.NewWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func gzipOf(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestS3Remote_SyncArchive(t *testing.T) {
+	s := newFakeS3(t)
+	local := useFakeS3(t, s, dynamic.ToolchainInfo{OS: "linux", Arch: "amd64v1", Compiler: "go1.24.0", Variant: "generic"})
+	dynamic.UsePackageMode("archived", dynamic.PackageModeProcess)
+
+	path := filepath.Join(t.TempDir(), "archive"+dynamic.ArchiveSuffix)
+	writeArchive(t, path, map[string]string{"bin_default_archived_v1": "binary"})
+	archive, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("linux_amd64v1_go1.24.0_generic/default_archived_v1"+dynamic.ArchiveSuffix, archive)
+
+	if err := dynamic.Prefetch(context.Background(), []dynamic.PackageRef{{Package: "archived", Version: "v1"}}); err != nil {
+		t.Fatalf("Prefetch err=%v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(local, "linux_amd64v1_go1.24.0_generic", "default_archived_v1", "bin_default_archived_v1"))
+	if err != nil || string(data) != "binary" {
+		t.Fatalf("unpacked file=%q,%v want %q", data, err, "binary")
+	}
+
+	want := []string{
+		"LIST ",
+		"LIST linux_amd64v1_go1.24.0_generic/default_archived_v1",
+		// the first part of the archive holds all of it.
+		"GET linux_amd64v1_go1.24.0_generic/default_archived_v1" + dynamic.ArchiveSuffix + " bytes=0-16777215",
+	}
+	if got := s.Requests(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("requests=%q want %q", got, want)
+	}
+}
+
+// plainRemote is a Remote written before RemoteV2, it only has Sync.
+type plainRemote struct {
+	local  string
+	synced []string
+}
+
+func (r *plainRemote) Sync(name string) error {
+	r.synced = append(r.synced, name)
+	dir := filepath.Join(r.local, dynamic.CurrentToolchain().String(), name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "libgo_"+name+".so"), []byte("plugin"), 0644)
+}
+
+func (r *plainRemote) Path() string {
+	return "plain://" + r.local
+}
+
+func TestWarehouse_PlainRemote(t *testing.T) {
+	w := dynamic.NewWarehouse()
+	local := t.TempDir()
+	w.Init(local, "")
+	remote := &plainRemote{local: local}
+	w.Remote = remote
+
+	if err := w.Sync(context.Background(), "default_plain_v1"); err != nil {
+		t.Fatalf("Sync err=%v", err)
+	}
+	if !reflect.DeepEqual(remote.synced, []string{"default_plain_v1"}) {
+		t.Fatalf("synced=%q want default_plain_v1", remote.synced)
+	}
+	if !w.Local.Exists("default_plain_v1") {
+		t.Fatal("Exists=false after Sync")
+	}
+}
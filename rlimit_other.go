@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+
+package dynamic
+
+import (
+	"log"
+	"os"
+	"os/exec"
+)
+
+// limitCommand leaves cmd as is, rlimits are not supported on this platform.
+func limitCommand(cmd *exec.Cmd) error {
+	return nil
+}
+
+// applyRLimits is not supported on this platform, limits are ignored.
+func applyRLimits() error {
+	if os.Getenv(EnvRLimitMemory) != "" || os.Getenv(EnvRLimitCPU) != "" {
+		log.Printf("[dynamic] rlimits are not supported on this platform")
+	}
+	return nil
+}
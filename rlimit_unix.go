@@ -0,0 +1,70 @@
+//go:build linux || darwin
+
+package dynamic
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// A host started with EnvRLimitExec set is the wrapper of a limited process
+// package: it sets the rlimits and executes the package in its place, so
+// that they hold before the package runs any code.
+func init() {
+	if path := os.Getenv(EnvRLimitExec); path != "" {
+		os.Exit(execLimited(path))
+	}
+}
+
+func execLimited(path string) int {
+	os.Unsetenv(EnvRLimitExec)
+	if err := applyRLimits(); err != nil {
+		log.Printf("[dynamic] limit process %s failed: %v", path, err)
+		return 1
+	}
+	err := syscall.Exec(path, []string{path}, os.Environ())
+	log.Printf("[dynamic] exec process %s failed: %v", path, err)
+	return 1
+}
+
+// limitCommand makes cmd run through the host executable as a wrapper
+// applying the rlimits of its environment.
+func limitCommand(cmd *exec.Cmd) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find host executable, %w", err)
+	}
+	cmd.Env = append(cmd.Env, EnvRLimitExec+"="+cmd.Path)
+	cmd.Path = exe
+	cmd.Args = []string{exe}
+	return nil
+}
+
+// applyRLimits sets the rlimits the host passed to a process package.
+func applyRLimits() error {
+	limits := []struct {
+		env      string
+		resource int
+	}{
+		{EnvRLimitMemory, syscall.RLIMIT_AS},
+		{EnvRLimitCPU, syscall.RLIMIT_CPU},
+	}
+	for _, limit := range limits {
+		s := os.Getenv(limit.env)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("dynamic: invalid %s %q, %w", limit.env, s, err)
+		}
+		if err := syscall.Setrlimit(limit.resource, &syscall.Rlimit{Cur: v, Max: v}); err != nil {
+			return fmt.Errorf("dynamic: set %s, %w", limit.env, err)
+		}
+	}
+	return nil
+}
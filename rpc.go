@@ -0,0 +1,229 @@
+package dynamic
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// EnvRPCSocket tells a process package to dial the host on a Unix socket
+// instead of speaking over stdin/stdout.
+const EnvRPCSocket = "DYNAMIC_RPC_SOCKET"
+
+const maxRPCFrameSize = 256 << 20
+
+const (
+	rpcKindMeta   = "meta"
+	rpcKindInit   = "init"
+	rpcKindInvoke = "invoke"
+	rpcKindCancel = "cancel"
+	rpcKindClose  = "close"
+)
+
+// rpcFrame is the message exchanged between host and process package,
+// written as a big-endian uint32 length followed by its JSON encoding.
+// A response carries the ID of its request.
+type rpcFrame struct {
+	ID      uint64 `json:"id"`
+	Kind    string `json:"kind"`
+	Method  string `json:"method,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RemoteError is an error returned by a tunnel running in another process.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func writeRPCFrame(w io.Writer, f *rpcFrame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxRPCFrameSize {
+		return fmt.Errorf("dynamic: rpc frame of %d bytes too large", len(data))
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func readRPCFrame(r io.Reader) (*rpcFrame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxRPCFrameSize {
+		return nil, fmt.Errorf("dynamic: rpc frame of %d bytes too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	var f rpcFrame
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Serve runs t, a Tunnel or TunnelV2, as a process package: the main of a
+// binary built from the same implementation as the plugin, e.g.
+//
+//	func main() {
+//		if err := dynamic.Serve(&Tunnel); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// It applies the rlimits set in ProcessOptions and answers the host until
+// it is closed. Over stdio, os.Stdout is
+// redirected to os.Stderr so stray prints can't corrupt the protocol.
+func Serve(t any) error {
+	var tunnel TunnelV2
+	switch v := t.(type) {
+	case TunnelV2:
+		tunnel = v
+	case Tunnel:
+		tunnel = AsTunnelV2(v)
+	default:
+		return errors.New("dynamic: symbol is not a Tunnel")
+	}
+
+	if err := applyRLimits(); err != nil {
+		return err
+	}
+
+	if path := os.Getenv(EnvRPCSocket); path != "" {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return fmt.Errorf("dynamic: dial host socket %s, %w", path, err)
+		}
+		defer conn.Close()
+		return newRPCServer(tunnel, conn, conn).serve()
+	}
+
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return newRPCServer(tunnel, os.Stdin, stdout).serve()
+}
+
+type rpcServer struct {
+	tunnel  TunnelV2
+	r       *bufio.Reader
+	wmu     sync.Mutex
+	w       io.Writer
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newRPCServer(tunnel TunnelV2, r io.Reader, w io.Writer) *rpcServer {
+	return &rpcServer{
+		tunnel:  tunnel,
+		r:       bufio.NewReader(r),
+		w:       w,
+		cancels: make(map[uint64]context.CancelFunc),
+	}
+}
+
+func (s *rpcServer) serve() error {
+	defer s.wg.Wait()
+
+	for {
+		req, err := readRPCFrame(s.r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		switch req.Kind {
+		case rpcKindMeta:
+			var meta string
+			err := protect(func() error {
+				meta = s.tunnel.Meta()
+				return nil
+			})
+			s.reply(req, []byte(meta), err)
+		case rpcKindInit:
+			s.reply(req, nil, protect(func() error {
+				ctx := context.Background()
+				if dir := os.Getenv(EnvAssetDir); dir != "" {
+					ctx = WithAssetDir(ctx, dir)
+				}
+				return s.tunnel.Init(ctx)
+			}))
+		case rpcKindInvoke:
+			ctx, cancel := context.WithCancel(context.Background())
+			s.mu.Lock()
+			s.cancels[req.ID] = cancel
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func(req *rpcFrame) {
+				defer s.wg.Done()
+				var out []byte
+				err := protect(func() (err error) {
+					out, err = s.tunnel.Invoke(ctx, req.Method, req.Payload)
+					return err
+				})
+				s.mu.Lock()
+				delete(s.cancels, req.ID)
+				s.mu.Unlock()
+				cancel()
+				s.reply(req, out, err)
+			}(req)
+		case rpcKindCancel:
+			s.mu.Lock()
+			if cancel, ok := s.cancels[req.ID]; ok {
+				cancel()
+			}
+			s.mu.Unlock()
+		case rpcKindClose:
+			s.wg.Wait()
+			s.reply(req, nil, protect(func() error {
+				return s.tunnel.Close(context.Background())
+			}))
+			return nil
+		default:
+			s.reply(req, nil, fmt.Errorf("dynamic: unknown rpc kind %s", req.Kind))
+		}
+	}
+}
+
+func (s *rpcServer) reply(req *rpcFrame, payload []byte, err error) {
+	resp := &rpcFrame{
+		ID:      req.ID,
+		Kind:    req.Kind,
+		Payload: payload,
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if err := writeRPCFrame(s.w, resp); err != nil {
+		fmt.Fprintf(os.Stderr, "[dynamic] write rpc reply failed: %v\n", err)
+	}
+}
@@ -1,70 +1,318 @@
 package dynamic
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 )
 
+const (
+	VariantGeneric = "generic"
+	// VariantAuto derives the variant from a hash of the build settings that
+	// plugins must share with the host (tags, cgo, trimpath...).
+	VariantAuto = "auto"
+)
+
 type Toolchain struct {
 	sync.Once
 	OS       string
 	Arch     string
 	Compiler string
 	Variant  string
+	// Libc is the libc of the host, e.g. glibc2.36, appended to the OS in
+	// String. Candidates probes the OS without it first, as publishers
+	// don't all emit libc-tagged directories yet.
+	Libc string
+
+	mu          sync.RWMutex
+	settings    []string
+	osAliases   map[string][]string
+	equivalents map[string][]string
+	libcRules   map[string]LibcRule
 }
 
 var toolchain = NewToolchain()
 
 func NewToolchain() *Toolchain {
-	return &Toolchain{}
+	return &Toolchain{
+		osAliases:   make(map[string][]string),
+		equivalents: make(map[string][]string),
+		libcRules:   make(map[string]LibcRule),
+	}
 }
 
 func (t *Toolchain) init() {
 	t.Do(func() {
-		if DynamicOS != "" {
-			t.OS = DynamicOS
-		} else {
-			t.OS = os.Getenv("DYNAMIC_OS")
-		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		o := readToolchainOverrides()
+
+		t.OS = o.OS
 		if t.OS == "" {
-			t.OS = env.GetOS()
+			t.OS = sanitizeSegment(env.GetOS())
 		}
 		log.Printf("[dynamic] toolchain os: %s", t.OS)
 
-		if DynamicArch != "" {
-			t.Arch = DynamicArch
-		} else {
-			t.Arch = os.Getenv("DYNAMIC_ARCH")
-		}
+		t.Arch = o.Arch
 		if t.Arch == "" {
-			t.Arch = env.GetArch()
+			t.Arch = sanitizeSegment(env.GetArch())
 		}
 		log.Printf("[dynamic] toolchain arch: %s", t.Arch)
 
-		if DynamicCompiler != "" {
-			t.Compiler = DynamicCompiler
-		} else {
-			t.Compiler = os.Getenv("DYNAMIC_COMPILER")
-		}
+		t.Compiler = o.Compiler
 		if t.Compiler == "" {
-			t.Compiler = env.GetCompiler()
+			t.Compiler = sanitizeSegment(env.GetCompiler())
 		}
 		log.Printf("[dynamic] toolchain compiler: %s", t.Compiler)
 
-		if DynamicVariant != "" {
-			t.Variant = DynamicVariant
-		} else {
-			t.Variant = os.Getenv("DYNAMIC_VARIANT")
-		}
+		t.Variant = o.Variant
 		if t.Variant == "" {
-			t.Variant = "generic" // 包含构建参数和so的路径都必须固定
+			t.Variant = VariantGeneric // 包含构建参数和so的路径都必须固定
+		} else if t.Variant == VariantAuto {
+			t.Variant = env.GetVariant()
 		}
 		log.Printf("[dynamic] toolchain variant: %s", t.Variant)
+		t.settings = env.GetVariantSettings()
+
+		t.Libc = o.Libc
+		if t.Libc == "" {
+			t.Libc = env.GetLibc().String()
+		}
+		log.Printf("[dynamic] toolchain libc: %s", t.Libc)
 	})
 }
 
+// readToolchainOverrides returns the components injected by ldflags, or
+// else by the environment, empty when not injected or invalid.
+func readToolchainOverrides() ToolchainInfo {
+	return ToolchainInfo{
+		OS:       override("os", DynamicOS, "DYNAMIC_OS"),
+		Arch:     override("arch", DynamicArch, "DYNAMIC_ARCH"),
+		Compiler: override("compiler", DynamicCompiler, "DYNAMIC_COMPILER"),
+		Variant:  override("variant", DynamicVariant, "DYNAMIC_VARIANT"),
+		Libc:     override("libc", DynamicLibc, "DYNAMIC_LIBC"),
+	}
+}
+
+// override returns the component injected by ldflags, or else by the
+// environment. One that is not a safe path segment is ignored, the
+// component is then detected.
+func override(component string, ldflag string, envKey string) string {
+	v := ldflag
+	if v == "" {
+		v = os.Getenv(envKey)
+	}
+	if v != "" && !allowed.IsSegment(v) {
+		log.Printf("[dynamic] invalid toolchain %s %q ignored", component, v)
+		return ""
+	}
+	return v
+}
+
+// sanitizeSegment replaces the characters of a detected component that
+// are not allowed in a path segment.
+func sanitizeSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x80 && (r == '.' || r == '+' || r == '-' ||
+			'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return r
+		}
+		return '-'
+	}, s)
+	s = strings.TrimLeft(s, ".+-")
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// Use replaces the toolchain, detected or injected, with info. The variant
+// VariantAuto is resolved from the build settings of the running binary,
+// the settings of info are kept as they are otherwise.
+func (t *Toolchain) Use(info ToolchainInfo) error {
+	if info.Variant == VariantAuto {
+		info.Variant = env.GetVariant()
+		info.Settings = env.GetVariantSettings()
+	}
+	if err := info.Validate(); err != nil {
+		return err
+	}
+
+	// the toolchain is replaced as a whole, it is not detected anymore.
+	t.Do(func() {})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.OS = info.OS
+	t.Arch = info.Arch
+	t.Compiler = info.Compiler
+	t.Variant = info.Variant
+	t.Libc = info.Libc
+	t.settings = slices.Clone(info.Settings)
+	log.Printf("[dynamic] use toolchain: %s", info)
+
+	return nil
+}
+
 func (t *Toolchain) String() string {
+	return t.Info().String()
+}
+
+func (t *Toolchain) Info() ToolchainInfo {
 	t.init()
-	return t.OS + "_" + t.Arch + "_" + t.Compiler + "_" + t.Variant
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return ToolchainInfo{
+		OS:       t.OS,
+		Arch:     t.Arch,
+		Compiler: t.Compiler,
+		Variant:  t.Variant,
+		Libc:     t.Libc,
+		Settings: slices.Clone(t.settings),
+	}
+}
+
+// Describe renders the full descriptor of the toolchain, including the
+// build settings behind the variant when known, for build pipelines to
+// target it.
+func (t *Toolchain) Describe() string {
+	info := t.Info()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "toolchain: %s\n", info)
+	fmt.Fprintf(&b, "os:        %s\n", info.OS)
+	fmt.Fprintf(&b, "arch:      %s\n", info.Arch)
+	fmt.Fprintf(&b, "compiler:  %s\n", info.Compiler)
+	fmt.Fprintf(&b, "variant:   %s\n", info.Variant)
+	fmt.Fprintf(&b, "libc:      %s", info.Libc)
+	if len(info.Settings) > 0 {
+		fmt.Fprintf(&b, "\nbuild:     %s (%s)", strings.Join(info.Settings, " "), variantOf(info.Settings))
+	}
+	return b.String()
+}
+
+// UseOSAlias lets packages built for aliases be loaded on os,
+// e.g. UseOSAlias("ubuntu22.04", "debian12").
+func (t *Toolchain) UseOSAlias(osDesc string, aliases ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.osAliases[osDesc] = append(t.osAliases[osDesc], aliases...)
+}
+
+// UseEquivalent lets packages built for the equivalent toolchains be loaded
+// on toolchain, they are probed after every generated candidate.
+func (t *Toolchain) UseEquivalent(toolchain string, equivalents ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.equivalents[toolchain] = append(t.equivalents[toolchain], equivalents...)
+}
+
+// UseLibcRule lets a host whose libc matches the rule's flavor load
+// packages published for an older libc down to the rule's minimum, e.g.
+// under glibc2.31_amd64v1_go1.24.0_generic for "glibc >= 2.31".
+func (t *Toolchain) UseLibcRule(rule LibcRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.libcRules[rule.Flavor] = rule
+}
+
+// Candidates returns the toolchain directories compatible with t, best
+// first: the OS without libc, then String() itself, each followed by its
+// microarch downgrades, then relaxed OS versions and OS aliases, then libc
+// descriptors allowed by the libc rules, then configured equivalents of
+// either of the first two.
+// The compiler and variant always match exactly.
+func (t *Toolchain) Candidates() []string {
+	t.init()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	oses := []string{t.OS}
+	if t.Libc != "" {
+		oses = append(oses, t.OS+"-"+t.Libc)
+	}
+	for _, osDesc := range append([]string{t.OS}, t.osAliases[t.OS]...) {
+		oses = append(oses, relaxOS(osDesc)...)
+	}
+	if libc, err := ParseLibc(t.Libc); err == nil {
+		for _, compatible := range libc.Compatible(t.libcRules[libc.Flavor]) {
+			oses = append(oses, compatible.String())
+		}
+	}
+
+	var candidates []string
+	seen := map[string]bool{}
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			candidates = append(candidates, s)
+		}
+	}
+	for _, osDesc := range oses {
+		for _, arch := range downgradeArch(t.Arch) {
+			add(osDesc + "_" + arch + "_" + t.Compiler + "_" + t.Variant)
+		}
+	}
+	exact := ToolchainInfo{OS: t.OS, Arch: t.Arch, Compiler: t.Compiler, Variant: t.Variant, Libc: t.Libc}.String()
+	for _, toolchain := range []string{candidates[0], exact} {
+		for _, s := range t.equivalents[toolchain] {
+			add(s)
+		}
+	}
+	return candidates
+}
+
+// relaxOS returns os followed by its version truncated one component at a
+// time down to the major version, e.g. alpine3.19.1, alpine3.19, alpine3.
+func relaxOS(osDesc string) []string {
+	relaxed := []string{osDesc}
+	for {
+		i := strings.LastIndex(osDesc, ".")
+		if i < 0 {
+			return relaxed
+		}
+		osDesc = osDesc[:i]
+		relaxed = append(relaxed, osDesc)
+	}
+}
+
+// downgradeArch returns arch followed by the older microarchitecture
+// levels able to run on it, e.g. amd64v3, amd64v2, amd64v1.
+func downgradeArch(arch string) []string {
+	var prefix string
+	switch {
+	case strings.HasPrefix(arch, "amd64v"):
+		prefix = "amd64v"
+	case strings.HasPrefix(arch, "armv"):
+		prefix = "armv"
+	default:
+		return []string{arch}
+	}
+
+	level, err := strconv.Atoi(strings.TrimPrefix(arch, prefix))
+	if err != nil {
+		return []string{arch}
+	}
+	lowest := 1
+	if prefix == "armv" {
+		lowest = 5
+	}
+
+	archs := []string{arch}
+	for l := level - 1; l >= lowest; l-- {
+		archs = append(archs, prefix+strconv.Itoa(l))
+	}
+	return archs
 }
@@ -0,0 +1,124 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ToolchainInfo is the structured form of a toolchain descriptor, the
+// directory name packages are published under.
+type ToolchainInfo struct {
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Compiler string `json:"compiler"`
+	Variant  string `json:"variant"`
+	// Libc is the libc of the host, e.g. glibc2.36, appended to the OS in
+	// String when known.
+	Libc string `json:"libc,omitempty"`
+	// Settings are the build settings behind the variant, only known for
+	// the current toolchain.
+	Settings []string `json:"settings,omitempty"`
+}
+
+// ParseToolchain is the inverse of ToolchainInfo.String, e.g.
+// "ubuntu22.04_amd64v3_go1.24.0_generic" or
+// "debian12-glibc2.36_amd64v3_go1.24.0_generic".
+func ParseToolchain(s string) (ToolchainInfo, error) {
+	parts := strings.SplitN(s, "_", 4)
+	if len(parts) != 4 {
+		return ToolchainInfo{}, fmt.Errorf("dynamic: invalid toolchain %q, want <os>[-<libc>]_<arch>_<compiler>_<variant>", s)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return ToolchainInfo{}, fmt.Errorf("dynamic: invalid toolchain %q, empty component", s)
+		}
+	}
+	info := ToolchainInfo{
+		OS:       parts[0],
+		Arch:     parts[1],
+		Compiler: parts[2],
+		Variant:  parts[3],
+	}
+	if i := strings.LastIndex(info.OS, "-"); i > 0 {
+		if libc, err := ParseLibc(info.OS[i+1:]); err == nil {
+			info.OS, info.Libc = info.OS[:i], libc.String()
+		}
+	}
+	return info, nil
+}
+
+// Validate checks that every component is a safe path segment, as they are
+// joined into filesystem paths and remote keys.
+func (i ToolchainInfo) Validate() error {
+	components := []struct {
+		name  string
+		value string
+	}{
+		{"os", i.OS},
+		{"arch", i.Arch},
+		{"compiler", i.Compiler},
+		{"variant", i.Variant},
+	}
+	for _, c := range components {
+		if !allowed.IsSegment(c.value) {
+			return fmt.Errorf("dynamic: invalid toolchain %s %q", c.name, c.value)
+		}
+	}
+	if i.Libc != "" {
+		if _, err := ParseLibc(i.Libc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i ToolchainInfo) String() string {
+	return i.osDescriptor() + "_" + i.Arch + "_" + i.Compiler + "_" + i.Variant
+}
+
+// osDescriptor returns the OS followed by the libc if known, e.g.
+// debian12-glibc2.36.
+func (i ToolchainInfo) osDescriptor() string {
+	if i.Libc == "" {
+		return i.OS
+	}
+	return i.OS + "-" + i.Libc
+}
+
+// MarshalJSON adds the descriptor string under "toolchain".
+func (i ToolchainInfo) MarshalJSON() ([]byte, error) {
+	type plain ToolchainInfo
+	return json.Marshal(struct {
+		Toolchain string `json:"toolchain"`
+		plain
+	}{
+		Toolchain: i.String(),
+		plain:     plain(i),
+	})
+}
+
+// UnmarshalJSON accepts the object written by MarshalJSON, or just its
+// "toolchain" string.
+func (i *ToolchainInfo) UnmarshalJSON(data []byte) error {
+	type plain ToolchainInfo
+	var v struct {
+		Toolchain string `json:"toolchain"`
+		plain
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	info := ToolchainInfo(v.plain)
+	if info.OS == "" && info.Arch == "" && info.Compiler == "" && info.Variant == "" && v.Toolchain != "" {
+		parsed, err := ParseToolchain(v.Toolchain)
+		if err != nil {
+			return err
+		}
+		parsed.Settings = info.Settings
+		info = parsed
+	}
+	*i = info
+	return nil
+}
@@ -0,0 +1,200 @@
+package dynamic_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+func TestParseToolchain(t *testing.T) {
+	s := "ubuntu22.04_amd64v3_go1.24.0_generic"
+	info, err := dynamic.ParseToolchain(s)
+	if err != nil {
+		t.Fatalf("ParseToolchain(%q) err=%v", s, err)
+	}
+	want := dynamic.ToolchainInfo{OS: "ubuntu22.04", Arch: "amd64v3", Compiler: "go1.24.0", Variant: "generic"}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("ParseToolchain(%q)=%+v want %+v", s, info, want)
+	}
+	if info.String() != s {
+		t.Fatalf("String()=%q want %q", info.String(), s)
+	}
+
+	s = "debian12-glibc2.36_amd64v3_go1.24.0_generic"
+	info, err = dynamic.ParseToolchain(s)
+	want = dynamic.ToolchainInfo{OS: "debian12", Arch: "amd64v3", Compiler: "go1.24.0", Variant: "generic", Libc: "glibc2.36"}
+	if err != nil || !reflect.DeepEqual(info, want) {
+		t.Fatalf("ParseToolchain(%q)=%+v,%v want %+v", s, info, err, want)
+	}
+	if info.String() != s {
+		t.Fatalf("String()=%q want %q", info.String(), s)
+	}
+
+	for _, bad := range []string{"", "linux", "linux_amd64_go1.24.0", "linux__go1.24.0_generic"} {
+		if _, err := dynamic.ParseToolchain(bad); err == nil {
+			t.Fatalf("ParseToolchain(%q) should fail", bad)
+		}
+	}
+}
+
+func TestToolchainInfo_JSON(t *testing.T) {
+	info := dynamic.ToolchainInfo{OS: "alpine3.19", Arch: "arm64v8", Compiler: "go1.24.0", Variant: "prod"}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Marshal err=%v", err)
+	}
+	want := `{"toolchain":"alpine3.19_arm64v8_go1.24.0_prod","os":"alpine3.19","arch":"arm64v8","compiler":"go1.24.0","variant":"prod"}`
+	if string(data) != want {
+		t.Fatalf("Marshal=%s want %s", data, want)
+	}
+
+	var got dynamic.ToolchainInfo
+	if err := json.Unmarshal(data, &got); err != nil || !reflect.DeepEqual(got, info) {
+		t.Fatalf("Unmarshal=%+v,%v want %+v", got, err, info)
+	}
+
+	got = dynamic.ToolchainInfo{}
+	if err := json.Unmarshal([]byte(`{"toolchain":"alpine3.19_arm64v8_go1.24.0_prod"}`), &got); err != nil || !reflect.DeepEqual(got, info) {
+		t.Fatalf("Unmarshal toolchain only=%+v,%v want %+v", got, err, info)
+	}
+}
+
+func TestToolchain_Candidates(t *testing.T) {
+	tc := dynamic.NewToolchain()
+	if err := tc.Use(dynamic.ToolchainInfo{OS: "alpine3.19.1", Arch: "amd64v3", Compiler: "go1.24.0", Variant: "generic"}); err != nil {
+		t.Fatalf("Use err=%v", err)
+	}
+	tc.UseOSAlias("alpine3.19.1", "alpine3.20")
+	tc.UseEquivalent("alpine3.19.1_amd64v3_go1.24.0_generic", "linux_amd64_go1.24.0_generic")
+
+	got := tc.Candidates()
+	want := []string{
+		"alpine3.19.1_amd64v3_go1.24.0_generic",
+		"alpine3.19.1_amd64v2_go1.24.0_generic",
+		"alpine3.19.1_amd64v1_go1.24.0_generic",
+		"alpine3.19_amd64v3_go1.24.0_generic",
+		"alpine3.19_amd64v2_go1.24.0_generic",
+		"alpine3.19_amd64v1_go1.24.0_generic",
+		"alpine3_amd64v3_go1.24.0_generic",
+		"alpine3_amd64v2_go1.24.0_generic",
+		"alpine3_amd64v1_go1.24.0_generic",
+		"alpine3.20_amd64v3_go1.24.0_generic",
+		"alpine3.20_amd64v2_go1.24.0_generic",
+		"alpine3.20_amd64v1_go1.24.0_generic",
+		"linux_amd64_go1.24.0_generic",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Candidates()=%v\nwant %v", got, want)
+	}
+
+	if err := tc.Use(dynamic.ToolchainInfo{OS: "../etc", Arch: "amd64", Compiler: "go1.24.0", Variant: "generic"}); err == nil {
+		t.Fatalf("Use with unsafe os should fail")
+	}
+}
+
+func TestToolchain_LibcCandidates(t *testing.T) {
+	tc := dynamic.NewToolchain()
+	if err := tc.Use(dynamic.ToolchainInfo{OS: "debian12", Arch: "arm64v8", Compiler: "go1.24.0", Variant: "generic", Libc: "glibc2.36"}); err != nil {
+		t.Fatalf("Use err=%v", err)
+	}
+	rule, err := dynamic.ParseLibcRule("glibc >= 2.34")
+	if err != nil {
+		t.Fatalf("ParseLibcRule err=%v", err)
+	}
+	tc.UseLibcRule(rule)
+
+	if want := "debian12-glibc2.36_arm64v8_go1.24.0_generic"; tc.String() != want {
+		t.Fatalf("String()=%q want %q", tc.String(), want)
+	}
+
+	got := tc.Candidates()
+	want := []string{
+		"debian12_arm64v8_go1.24.0_generic",
+		"debian12-glibc2.36_arm64v8_go1.24.0_generic",
+		"glibc2.36_arm64v8_go1.24.0_generic",
+		"glibc2.35_arm64v8_go1.24.0_generic",
+		"glibc2.34_arm64v8_go1.24.0_generic",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Candidates()=%v\nwant %v", got, want)
+	}
+
+	if _, err := dynamic.ParseLibcRule("uclibc >= 1.0"); err == nil {
+		t.Fatalf("ParseLibcRule with unknown flavor should fail")
+	}
+}
+
+func TestToolchain_InvalidOverride(t *testing.T) {
+	t.Setenv("DYNAMIC_OS", "bad/os")
+	t.Setenv("DYNAMIC_ARCH", "arm64v9")
+
+	tc := dynamic.NewToolchain()
+	info := tc.Info()
+	if info.OS == "" || info.OS == "bad/os" || info.Arch != "arm64v9" {
+		t.Fatalf("Info()=%+v want the os detected and the arch overridden", info)
+	}
+
+	// the overrides are read once.
+	t.Setenv("DYNAMIC_ARCH", "arm64v10")
+	if got := tc.Info(); got.Arch != "arm64v9" {
+		t.Fatalf("Info().Arch=%q after changing the env want %q", got.Arch, "arm64v9")
+	}
+}
+
+func TestToolchain_UseSkipsOverrides(t *testing.T) {
+	t.Setenv("DYNAMIC_OS", "overridden")
+
+	tc := dynamic.NewToolchain()
+	info := dynamic.ToolchainInfo{OS: "debian12", Arch: "amd64v3", Compiler: "go1.24.0", Variant: "prod"}
+	if err := tc.Use(info); err != nil {
+		t.Fatalf("Use err=%v", err)
+	}
+	if got := tc.Info(); !reflect.DeepEqual(got, info) {
+		t.Fatalf("Info()=%+v want %+v without settings", got, info)
+	}
+
+	info.Variant = dynamic.VariantAuto
+	if err := tc.Use(info); err != nil {
+		t.Fatalf("Use auto err=%v", err)
+	}
+	host := dynamic.NewEnv()
+	if got := tc.Info(); got.Variant != host.GetVariant() || !reflect.DeepEqual(got.Settings, host.GetVariantSettings()) {
+		t.Fatalf("Info() after Use auto=%+v want variant %q and the host settings", got, host.GetVariant())
+	}
+}
+
+func TestToolchain_Describe(t *testing.T) {
+	tc := dynamic.NewToolchain()
+	if err := tc.Use(dynamic.ToolchainInfo{OS: "debian12", Arch: "amd64v3", Compiler: "go1.24.0", Variant: dynamic.VariantAuto, Libc: "glibc2.36"}); err != nil {
+		t.Fatalf("Use err=%v", err)
+	}
+
+	desc := tc.Describe()
+	host := dynamic.NewEnv()
+	for _, want := range []string{
+		"toolchain: " + tc.String(),
+		"os:        debian12",
+		"arch:      amd64v3",
+		"compiler:  go1.24.0",
+		"variant:   " + host.GetVariant(),
+		"libc:      glibc2.36",
+		"build:     " + strings.Join(host.GetVariantSettings(), " ") + " (" + host.GetVariant() + ")",
+	} {
+		if !strings.Contains(desc, want+"\n") && !strings.HasSuffix(desc, want) {
+			t.Errorf("Describe() misses %q:\n%s", want, desc)
+		}
+	}
+}
+
+func TestToolchain_DescribeWithoutSettings(t *testing.T) {
+	tc := dynamic.NewToolchain()
+	if err := tc.Use(dynamic.ToolchainInfo{OS: "debian12", Arch: "amd64v3", Compiler: "go1.24.0", Variant: "prod"}); err != nil {
+		t.Fatalf("Use err=%v", err)
+	}
+	if desc := tc.Describe(); strings.Contains(desc, "build:") {
+		t.Fatalf("Describe() of an overridden variant=\n%s\nwant no build settings", desc)
+	}
+}
@@ -1,8 +1,12 @@
 package dynamic
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
 	"sync"
+	"time"
 )
 
 type Tunnel interface {
@@ -12,6 +16,15 @@ type Tunnel interface {
 	Close()
 }
 
+// TunnelV2 is the error-returning, context-aware form of Tunnel.
+// A package may export either one, TunnelCenter detects which by type assertion.
+type TunnelV2 interface {
+	Meta() string
+	Init(ctx context.Context) error
+	Invoke(ctx context.Context, method string, payload []byte) ([]byte, error)
+	Close(ctx context.Context) error
+}
+
 type Template struct{}
 
 func (t *Template) Init() {
@@ -28,9 +41,132 @@ func (t *Template) Meta() string {
 	return ""
 }
 
+type TemplateV2 struct{}
+
+func (t *TemplateV2) Init(ctx context.Context) error {
+	return nil
+}
+
+func (t *TemplateV2) Close(ctx context.Context) error {
+	return nil
+}
+
+func (t *TemplateV2) Invoke(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (t *TemplateV2) Meta() string {
+	return ""
+}
+
+// AsTunnelV2 returns the TunnelV2 behind t. Tunnels loaded from v2 packages
+// are unwrapped, v1 tunnels are adapted.
+func AsTunnelV2(t Tunnel) TunnelV2 {
+	if u, ok := t.(interface{ TunnelV2() TunnelV2 }); ok {
+		return u.TunnelV2()
+	}
+	return &tunnelV1Adapter{tunnel: t}
+}
+
+// AsTunnel presents t as a v1 Tunnel, errors are logged and dropped.
+func AsTunnel(t TunnelV2) Tunnel {
+	if a, ok := t.(*tunnelV1Adapter); ok {
+		return a.tunnel
+	}
+	return &tunnelV2Adapter{tunnel: t}
+}
+
+// findTunnel walks the wrappers around t (interceptors, guards and
+// adapters) and returns the first layer that is a T.
+func findTunnel[T any](t Tunnel) (T, bool) {
+	var v any = t
+	for v != nil {
+		if found, ok := v.(T); ok {
+			return found, true
+		}
+		switch u := v.(type) {
+		case interface{ Unwrap() Tunnel }:
+			v = u.Unwrap()
+		case interface{ Unwrap() TunnelV2 }:
+			v = u.Unwrap()
+		case interface{ TunnelV2() TunnelV2 }:
+			v = u.TunnelV2()
+		default:
+			v = nil
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+type tunnelV1Adapter struct {
+	tunnel Tunnel
+}
+
+func (a *tunnelV1Adapter) Unwrap() Tunnel {
+	return a.tunnel
+}
+
+func (a *tunnelV1Adapter) Meta() string {
+	return a.tunnel.Meta()
+}
+
+func (a *tunnelV1Adapter) Init(ctx context.Context) error {
+	a.tunnel.Init()
+	return nil
+}
+
+func (a *tunnelV1Adapter) Invoke(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []byte(a.tunnel.Invoke(method, string(payload))), nil
+}
+
+func (a *tunnelV1Adapter) Close(ctx context.Context) error {
+	a.tunnel.Close()
+	return nil
+}
+
+type tunnelV2Adapter struct {
+	tunnel TunnelV2
+}
+
+func (a *tunnelV2Adapter) TunnelV2() TunnelV2 {
+	return a.tunnel
+}
+
+func (a *tunnelV2Adapter) Meta() string {
+	return a.tunnel.Meta()
+}
+
+func (a *tunnelV2Adapter) Init() {
+	if err := a.tunnel.Init(context.Background()); err != nil {
+		log.Printf("[dynamic] init tunnel failed: %v", err)
+	}
+}
+
+func (a *tunnelV2Adapter) Invoke(name string, args string) string {
+	out, err := a.tunnel.Invoke(context.Background(), name, []byte(args))
+	if err != nil {
+		log.Printf("[dynamic] invoke tunnel method %s failed: %v", name, err)
+		return ""
+	}
+	return string(out)
+}
+
+func (a *tunnelV2Adapter) Close() {
+	if err := a.tunnel.Close(context.Background()); err != nil {
+		log.Printf("[dynamic] close tunnel failed: %v", err)
+	}
+}
+
 type TunnelCenter struct {
-	mu      sync.Mutex
-	tunnels map[string]Tunnel
+	mu         sync.Mutex
+	tunnels    map[string]Tunnel
+	fmu        sync.Mutex
+	faults     map[string]*Fault
+	quarantine time.Duration
 }
 
 var tunnelCenter = NewTunnelCenter()
@@ -38,9 +174,19 @@ var tunnelCenter = NewTunnelCenter()
 func NewTunnelCenter() *TunnelCenter {
 	return &TunnelCenter{
 		tunnels: make(map[string]Tunnel),
+		faults:  make(map[string]*Fault),
 	}
 }
 
+// UseQuarantine refuses to load a tunnel again for d after it panicked.
+// Zero disables quarantine.
+func (tc *TunnelCenter) UseQuarantine(d time.Duration) {
+	tc.fmu.Lock()
+	defer tc.fmu.Unlock()
+
+	tc.quarantine = d
+}
+
 func (tc *TunnelCenter) GetTunnel(name string) (Tunnel, error) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
@@ -49,20 +195,42 @@ func (tc *TunnelCenter) GetTunnel(name string) (Tunnel, error) {
 		return tunnel, nil
 	}
 
-	pkg, err := warehouse.Load(name)
-	if err != nil {
+	if err := tc.checkQuarantine(name); err != nil {
 		return nil, err
 	}
 
-	tunnel, ok := pkg.(Tunnel)
-	if !ok {
+	var pkg any
+	if err := protect(func() (err error) {
+		pkg, err = warehouse.Load(name)
+		return err
+	}); err != nil {
+		tc.recordFault(name, err)
+		return nil, err
+	}
+
+	var tunnel Tunnel
+	switch t := pkg.(type) {
+	case Tunnel:
+		tunnel = t
+	case TunnelV2:
+		tunnel = AsTunnel(t)
+	default:
 		return nil, errors.New("dynamic: symbol is not a Tunnel")
 	}
 
-	tunnel.Init()
-	tc.tunnels[name] = tunnel
+	ctx := context.Background()
+	if dir, ok := warehouse.AssetDir(name); ok {
+		ctx = WithAssetDir(ctx, dir)
+	}
+	return tc.register(ctx, name, tunnel)
+}
 
-	return tunnel, nil
+func (tc *TunnelCenter) HasTunnel(name string) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	_, ok := tc.tunnels[name]
+	return ok
 }
 
 func (tc *TunnelCenter) CloseTunnel(name string) error {
@@ -70,8 +238,8 @@ func (tc *TunnelCenter) CloseTunnel(name string) error {
 	defer tc.mu.Unlock()
 
 	if tunnel, ok := tc.tunnels[name]; ok {
-		tunnel.Close()
 		delete(tc.tunnels, name)
+		return AsTunnelV2(tunnel).Close(context.Background())
 	}
 
 	return nil
@@ -90,9 +258,85 @@ func (tc *TunnelCenter) RangeTunnel(f func(string, Tunnel) bool) {
 
 // RegisterTunnel is usually used in debug mode
 func (tc *TunnelCenter) RegisterTunnel(name string, tunnel Tunnel) {
+	if _, err := tc.TryRegisterTunnel(name, tunnel); err != nil {
+		log.Printf("[dynamic] register tunnel %s failed: %v", name, err)
+	}
+}
+
+// TryRegisterTunnel is RegisterTunnel returning the tunnel as guarded by the
+// center, or the error of its Init.
+func (tc *TunnelCenter) TryRegisterTunnel(name string, tunnel Tunnel) (Tunnel, error) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
-	tunnel.Init()
+	return tc.register(context.Background(), name, tunnel)
+}
+
+// register guards the tunnel and initializes it with ctx.
+func (tc *TunnelCenter) register(ctx context.Context, name string, tunnel Tunnel) (Tunnel, error) {
+	guarded := newGuardedTunnel(AsTunnelV2(tunnel), func(err error) {
+		tc.recordFault(name, err)
+	}, func() error {
+		return tc.checkQuarantine(name)
+	})
+	if err := guarded.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	tunnel = AsTunnel(guarded)
 	tc.tunnels[name] = tunnel
+	return tunnel, nil
+}
+
+// Fault returns the last recorded panic of the tunnel.
+func (tc *TunnelCenter) Fault(name string) (Fault, bool) {
+	tc.fmu.Lock()
+	defer tc.fmu.Unlock()
+
+	if fault, ok := tc.faults[name]; ok {
+		return *fault, true
+	}
+	return Fault{}, false
+}
+
+// ResetFault forgets the panics of the tunnel, lifting its quarantine.
+func (tc *TunnelCenter) ResetFault(name string) {
+	tc.fmu.Lock()
+	defer tc.fmu.Unlock()
+
+	delete(tc.faults, name)
+}
+
+func (tc *TunnelCenter) recordFault(name string, err error) {
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		return
+	}
+	log.Printf("[dynamic] tunnel %s faulted: %v", name, err)
+
+	tc.fmu.Lock()
+	defer tc.fmu.Unlock()
+
+	fault, ok := tc.faults[name]
+	if !ok {
+		fault = &Fault{}
+		tc.faults[name] = fault
+	}
+	fault.Err = err
+	fault.Time = time.Now()
+	fault.Count++
+}
+
+func (tc *TunnelCenter) checkQuarantine(name string) error {
+	tc.fmu.Lock()
+	defer tc.fmu.Unlock()
+
+	fault, ok := tc.faults[name]
+	if !ok || tc.quarantine <= 0 {
+		return nil
+	}
+	if until := fault.Time.Add(tc.quarantine); time.Now().Before(until) {
+		return fmt.Errorf("%w: %s until %s, %w", ErrTunnelQuarantined, name, until.Format(time.RFC3339), fault.Err)
+	}
+	return nil
 }
@@ -0,0 +1,104 @@
+package dynamic_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+type echoTunnel struct {
+	dynamic.Template
+}
+
+func (t *echoTunnel) Invoke(name string, args string) string {
+	return name + ":" + args
+}
+
+type failTunnel struct {
+	dynamic.TemplateV2
+}
+
+func (t *failTunnel) Invoke(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	return nil, errors.New("boom")
+}
+
+func TestAsTunnelV2_AdaptsV1(t *testing.T) {
+	v2 := dynamic.AsTunnelV2(&echoTunnel{})
+	out, err := v2.Invoke(context.Background(), "echo", []byte("x"))
+	if err != nil || string(out) != "echo:x" {
+		t.Fatalf("Invoke=%q,%v want %q,nil", out, err, "echo:x")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := v2.Invoke(ctx, "echo", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Invoke with canceled ctx err=%v want context.Canceled", err)
+	}
+}
+
+func TestAsTunnel_RoundTrip(t *testing.T) {
+	v2 := &failTunnel{}
+	v1 := dynamic.AsTunnel(v2)
+	if got := v1.Invoke("any", ""); got != "" {
+		t.Fatalf("Invoke=%q want empty on error", got)
+	}
+	if dynamic.AsTunnelV2(v1) != dynamic.TunnelV2(v2) {
+		t.Fatalf("AsTunnelV2(AsTunnel(v2)) should unwrap to v2")
+	}
+
+	e := &echoTunnel{}
+	if dynamic.AsTunnel(dynamic.AsTunnelV2(e)) != dynamic.Tunnel(e) {
+		t.Fatalf("AsTunnel(AsTunnelV2(v1)) should unwrap to v1")
+	}
+}
+
+func TestGetPackageV2_NativeTunnelV2(t *testing.T) {
+	t.Setenv("DYNAMIC_TEST_SERVE", "1")
+
+	// process packages are native TunnelV2s, served by the test binary.
+	previous := dynamic.CurrentToolchain()
+	dynamic.UseToolchain(testDownloadToolchain)
+	local := t.TempDir()
+	dynamic.UseWarehouse(local, "")
+	dynamic.UsePackageMode("native", dynamic.PackageModeProcess)
+	t.Cleanup(func() {
+		dynamic.ClosePackage("native", "v1")
+		dynamic.UseToolchain(previous)
+	})
+	dir := filepath.Join(local, testDownloadToolchain.String(), "default_native_v1")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.Args[0], filepath.Join(dir, "bin_default_native_v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel, err := dynamic.GetPackageV2("native", "v1")
+	if err != nil {
+		t.Fatalf("GetPackageV2 err=%v", err)
+	}
+	// through a v1 adapter the error would be dropped and ctx ignored.
+	if _, err := tunnel.Invoke(context.Background(), "missing", nil); err == nil {
+		t.Fatal("Invoke of a missing method err=nil")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := tunnel.Invoke(ctx, "block", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("block err=%v want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("block ignored the deadline of its ctx")
+	}
+}
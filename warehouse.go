@@ -1,19 +1,76 @@
 package dynamic
 
 import (
+	"context"
+	"crypto/ed25519"
 	"errors"
+	"fmt"
 	"log"
+	"sync"
 )
 
+// PackageMode selects how a warehouse package is loaded.
+type PackageMode int
+
+const (
+	// PackageModePlugin opens libgo_<name>.so in-process with plugin.Open.
+	PackageModePlugin PackageMode = iota
+	// PackageModeProcess runs bin_<name> as a child process serving the
+	// tunnel over RPC, see Serve.
+	PackageModeProcess
+	// PackageModeWasm runs <name>.wasm from the toolchain independent
+	// "wasm" directory, see WasmTunnel.
+	PackageModeWasm
+)
+
+func (m PackageMode) String() string {
+	switch m {
+	case PackageModePlugin:
+		return "plugin"
+	case PackageModeProcess:
+		return "process"
+	case PackageModeWasm:
+		return "wasm"
+	default:
+		return "unknown"
+	}
+}
+
 type Warehouse struct {
-	Local  *Local
-	Remote Remote
+	Local           *Local
+	Remote          Remote
+	mu              sync.RWMutex
+	modes           map[string]PackageMode
+	processOptions  ProcessOptions
+	downloadOptions DownloadOptions
+	downloads       downloadProgress
+	limiter         *downloadLimiter
+	missing         *negativeCache
+	archiveKeys     []ed25519.PublicKey
+	smu             sync.Mutex
+	syncs           map[syncKey]*syncCall
+}
+
+type syncKey struct {
+	name string
+	mode PackageMode
+}
+
+// syncCall is a sync of a package in progress, shared by the callers
+// asking for the package meanwhile.
+type syncCall struct {
+	done chan struct{}
+	err  error
 }
 
 var warehouse = NewWarehouse()
 
 func NewWarehouse() *Warehouse {
-	return &Warehouse{}
+	return &Warehouse{
+		modes:   make(map[string]PackageMode),
+		missing: newNegativeCache(),
+		syncs:   make(map[syncKey]*syncCall),
+	}
 }
 
 func (w *Warehouse) Init(localPath, remotePath string) {
@@ -21,33 +78,208 @@ func (w *Warehouse) Init(localPath, remotePath string) {
 	w.Remote = NewRemote(remotePath)
 }
 
+// UseMode sets the mode of every version of pkg.
+func (w *Warehouse) UseMode(pkg string, mode PackageMode) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.modes[pkg] = mode
+}
+
+func (w *Warehouse) UseProcessOptions(opts ProcessOptions) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.processOptions = opts
+}
+
+func (w *Warehouse) UseDownloadOptions(opts DownloadOptions) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.downloadOptions = opts
+	w.limiter = newDownloadLimiter(opts)
+}
+
+func (w *Warehouse) DownloadOptions() DownloadOptions {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.downloadOptions
+}
+
+// UseArchiveKeys makes package archives only accepted when their manifest
+// is signed by one of keys.
+func (w *Warehouse) UseArchiveKeys(keys ...ed25519.PublicKey) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.archiveKeys = keys
+}
+
+func (w *Warehouse) ArchiveKeys() []ed25519.PublicKey {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.archiveKeys
+}
+
+func (w *Warehouse) downloadLimiter() *downloadLimiter {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.limiter
+}
+
+// Downloads returns the progress of the downloads in flight, oldest first.
+func (w *Warehouse) Downloads() []DownloadProgress {
+	return w.downloads.list()
+}
+
+func (w *Warehouse) trackDownload(name string, file string, total int64) *downloadTracker {
+	return w.downloads.track(name, file, total, w.DownloadOptions().Progress)
+}
+
+// Mode returns the mode of the package named by a DynamicIndex string.
+func (w *Warehouse) Mode(name string) PackageMode {
+	index, ok := ParseDynamicIndex(name)
+	if !ok {
+		return PackageModePlugin
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.modes[index.Package]
+}
+
 func (w *Warehouse) Load(name string) (any, error) {
-	log.Printf("[dynamic] load warehouse package %s...", name)
+	mode := w.Mode(name)
+	log.Printf("[dynamic] load warehouse package %s in %s mode...", name, mode)
 
+	if err := w.ensure(context.Background(), name, mode); err != nil {
+		return nil, err
+	}
+
+	var pkg any
+	var err error
+	switch mode {
+	case PackageModeProcess:
+		w.mu.RLock()
+		opts := w.processOptions
+		w.mu.RUnlock()
+		pkg, err = w.Local.Start(name, opts)
+	case PackageModeWasm:
+		pkg, err = w.Local.LoadWasm(name)
+	default:
+		pkg, err = w.Local.Load(name)
+	}
+	if err != nil {
+		log.Printf("[dynamic] load warehouse package %s failed: %v", name, err)
+		return nil, err
+	}
+
+	log.Printf("[dynamic] load warehouse load package %s success", name)
+	return pkg, nil
+}
+
+// AssetDir returns the asset directory of the package named by a
+// DynamicIndex string, if it is available locally and has one.
+func (w *Warehouse) AssetDir(name string) (string, bool) {
+	if w.Local == nil {
+		return "", false
+	}
+	return w.Local.AssetDir(name, w.Mode(name))
+}
+
+// Sync makes the package named by a DynamicIndex string available locally
+// without loading it, downloading it until ctx is done.
+func (w *Warehouse) Sync(ctx context.Context, name string) error {
+	return w.ensure(ctx, name, w.Mode(name))
+}
+
+// ensure makes the package available locally, syncing it from the remote
+// if needed. Concurrent calls for a package share a single sync, a caller
+// whose ctx is still running takes over one stopped by the ctx of another.
+func (w *Warehouse) ensure(ctx context.Context, name string, mode PackageMode) error {
+	key := syncKey{name, mode}
+	for {
+		w.smu.Lock()
+		call, ok := w.syncs[key]
+		if !ok {
+			call = &syncCall{done: make(chan struct{})}
+			w.syncs[key] = call
+			w.smu.Unlock()
+
+			call.err = w.ensureOnce(ctx, name, mode)
+			w.smu.Lock()
+			delete(w.syncs, key)
+			w.smu.Unlock()
+			close(call.done)
+			return call.err
+		}
+		w.smu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		stopped := errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)
+		if !stopped || ctx.Err() != nil {
+			return call.err
+		}
+	}
+}
+
+func (w *Warehouse) ensureOnce(ctx context.Context, name string, mode PackageMode) error {
 	if w.Local == nil {
-		return nil, errors.New("dynamic: warehouse package not exists")
+		return errors.New("dynamic: warehouse package not exists")
 	}
 
-	if !w.Local.Exists(name) {
+	if !w.Local.ExistsMode(name, mode) {
 		if w.Remote == nil {
-			return nil, errors.New("dynamic: warehouse package not exists")
+			return errors.New("dynamic: warehouse package not exists")
 		}
 
-		if err := w.Remote.Sync(name); err != nil {
-			return nil, err
+		// a package the remote recently didn't have is refused right
+		// away, unless it was put in the local warehouse since.
+		toolchainDir := ToolchainDirs(mode)[0]
+		if w.missing.Missing(name, toolchainDir) {
+			return fmt.Errorf("%w, cached as missing", ErrTunnelNotExits)
 		}
 
-		if !w.Local.Exists(name) {
-			return nil, errors.New("dynamic: warehouse package not exists")
+		if err := w.syncRemote(ctx, name, mode); err != nil {
+			if isTunnelNotExist(err) {
+				w.missing.Store(name, toolchainDir)
+			}
+			return err
 		}
+
+		if !w.Local.ExistsMode(name, mode) {
+			return errors.New("dynamic: warehouse package not exists")
+		}
+	}
+
+	return nil
+}
+
+func (w *Warehouse) syncRemote(ctx context.Context, name string, mode PackageMode) error {
+	if r, ok := w.Remote.(RemoteV2); ok {
+		return r.SyncMode(ctx, name, mode)
 	}
+	return w.Remote.Sync(name)
+}
 
-	pkg, err := w.Local.Load(name)
+// Check syncs the plugin of a package and compares its build with the host's
+// without opening it.
+func (w *Warehouse) Check(name string) (*CheckReport, error) {
+	if err := w.ensure(context.Background(), name, PackageModePlugin); err != nil {
+		return nil, err
+	}
+	path, err := w.Local.PluginPath(name)
 	if err != nil {
-		log.Printf("[dynamic] load warehouse package %s failed: %v", name, err)
 		return nil, err
 	}
-
-	log.Printf("[dynamic] load warehouse load package %s success", name)
-	return pkg, nil
+	return CheckPlugin(path)
 }
@@ -0,0 +1,293 @@
+package dynamic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WasmTunnel is a TunnelV2 backed by a WebAssembly module, run with WASI
+// by a pure-Go runtime. The module exports:
+//
+//	memory
+//	malloc(size u32) u32
+//	invoke(method_ptr, method_len, payload_ptr, payload_len u32) u64
+//
+// and optionally:
+//
+//	free(ptr, size u32)
+//	init()
+//	close()
+//	meta() u64
+//
+// invoke and meta return the result as ptr<<32 | len, the host copies it
+// and frees it when free is exported. invoke reports an error by calling
+// the imported dynamic.error(ptr, len u32) with its message.
+// Calls are serialized, a module instance is single-threaded. A call still
+// running when its ctx is done is stopped and the module closed, the next
+// call instantiates and initializes the module again.
+type WasmTunnel struct {
+	path    string
+	mu      sync.Mutex
+	runtime wazero.Runtime
+	module  api.Module
+	malloc  api.Function
+	free    api.Function
+	invoke  api.Function
+	meta    string
+	// stopped is set when a call closed the module, until it is reloaded.
+	stopped bool
+}
+
+func NewWasmTunnel(path string) *WasmTunnel {
+	return &WasmTunnel{
+		path: path,
+	}
+}
+
+type wasmCallKey struct{}
+
+type wasmCall struct {
+	err error
+}
+
+func (w *WasmTunnel) Meta() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.meta
+}
+
+// Init instantiates and initializes the module. Initializing it again closes
+// the previous instance first.
+func (w *WasmTunnel) Init(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.module != nil {
+		if err := w.close(ctx); err != nil {
+			log.Printf("[dynamic] close wasm %s failed: %v", w.path, err)
+		}
+	}
+	w.stopped = false
+	return w.load(ctx)
+}
+
+func (w *WasmTunnel) load(ctx context.Context) error {
+	code, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+
+	// a guest stuck in a loop is stopped once the ctx of its call is done.
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if err := w.instantiate(ctx, r, code); err != nil {
+		r.Close(ctx)
+		w.module = nil
+		return fmt.Errorf("dynamic: instantiate wasm %s, %w", w.path, err)
+	}
+	w.runtime = r
+
+	if f := w.module.ExportedFunction("init"); f != nil {
+		if _, err := f.Call(ctx); err != nil {
+			w.unload(ctx)
+			return fmt.Errorf("dynamic: init wasm %s, %w", w.path, err)
+		}
+	}
+
+	if f := w.module.ExportedFunction("meta"); f != nil {
+		results, err := f.Call(ctx)
+		if err != nil {
+			w.unload(ctx)
+			return fmt.Errorf("dynamic: meta wasm %s, %w", w.path, err)
+		}
+		meta, err := w.take(ctx, results[0])
+		if err != nil {
+			w.unload(ctx)
+			return err
+		}
+		w.meta = string(meta)
+	}
+
+	return nil
+}
+
+func (w *WasmTunnel) instantiate(ctx context.Context, r wazero.Runtime, code []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		return err
+	}
+
+	if _, err := r.NewHostModuleBuilder("dynamic").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+			call, ok := ctx.Value(wasmCallKey{}).(*wasmCall)
+			if !ok {
+				return
+			}
+			if msg, ok := m.Memory().Read(ptr, size); ok {
+				call.err = errors.New(string(msg))
+			} else {
+				call.err = errors.New("dynamic: wasm error out of memory range")
+			}
+		}).
+		Export("error").
+		Instantiate(ctx); err != nil {
+		return err
+	}
+
+	compiled, err := r.CompileModule(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	config := wazero.NewModuleConfig().
+		WithStdout(os.Stderr).
+		WithStderr(os.Stderr)
+	// Reactor modules (e.g. Go -buildmode=c-shared) are initialized by
+	// _initialize instead of running _start.
+	if _, ok := compiled.ExportedFunctions()["_initialize"]; ok {
+		config = config.WithStartFunctions("_initialize")
+	}
+
+	w.module, err = r.InstantiateModule(ctx, compiled, config)
+	if err != nil {
+		return err
+	}
+
+	w.malloc = w.module.ExportedFunction("malloc")
+	w.free = w.module.ExportedFunction("free")
+	w.invoke = w.module.ExportedFunction("invoke")
+	if w.malloc == nil || w.invoke == nil {
+		return errors.New("dynamic: wasm module must export malloc and invoke")
+	}
+	return nil
+}
+
+func (w *WasmTunnel) Invoke(ctx context.Context, method string, payload []byte) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.module == nil {
+		if !w.stopped {
+			return nil, errors.New("dynamic: wasm tunnel not initialized")
+		}
+		if err := w.load(ctx); err != nil {
+			return nil, err
+		}
+		w.stopped = false
+		log.Printf("[dynamic] reloaded wasm %s", w.path)
+	}
+	// a call stopped by its ctx leaves the module closed, drop it once the
+	// call is done so the next one reloads it.
+	defer func() {
+		if w.module != nil && w.module.IsClosed() {
+			w.unload(context.Background())
+			w.stopped = true
+		}
+	}()
+
+	methodPtr, err := w.put(ctx, []byte(method))
+	if err != nil {
+		return nil, err
+	}
+	defer w.release(ctx, methodPtr, uint32(len(method)))
+
+	payloadPtr, err := w.put(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer w.release(ctx, payloadPtr, uint32(len(payload)))
+
+	call := &wasmCall{}
+	results, err := w.invoke.Call(context.WithValue(ctx, wasmCallKey{}, call),
+		uint64(methodPtr), uint64(len(method)), uint64(payloadPtr), uint64(len(payload)))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%w, %w", ctxErr, err)
+		}
+		return nil, err
+	}
+
+	out, err := w.take(ctx, results[0])
+	if err != nil {
+		return nil, err
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	return out, nil
+}
+
+// Close runs the module's close and unloads the module entirely.
+func (w *WasmTunnel) Close(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = false
+	if w.module == nil {
+		return nil
+	}
+	return w.close(ctx)
+}
+
+func (w *WasmTunnel) close(ctx context.Context) error {
+	var err error
+	if f := w.module.ExportedFunction("close"); f != nil {
+		_, err = f.Call(ctx)
+	}
+	return errors.Join(err, w.unload(ctx))
+}
+
+func (w *WasmTunnel) unload(ctx context.Context) error {
+	err := w.runtime.Close(ctx)
+	w.runtime = nil
+	w.module = nil
+	return err
+}
+
+// put copies data into guest memory allocated by malloc.
+func (w *WasmTunnel) put(ctx context.Context, data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	results, err := w.malloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	ptr := uint32(results[0])
+	if !w.module.Memory().Write(ptr, data) {
+		return 0, errors.New("dynamic: wasm malloc out of memory range")
+	}
+	return ptr, nil
+}
+
+// take copies a packed ptr<<32 | len result out of guest memory and frees it.
+func (w *WasmTunnel) take(ctx context.Context, packed uint64) ([]byte, error) {
+	ptr, size := uint32(packed>>32), uint32(packed)
+	if size == 0 {
+		return nil, nil
+	}
+	data, ok := w.module.Memory().Read(ptr, size)
+	if !ok {
+		return nil, errors.New("dynamic: wasm result out of memory range")
+	}
+	out := append([]byte(nil), data...)
+	w.release(ctx, ptr, size)
+	return out, nil
+}
+
+func (w *WasmTunnel) release(ctx context.Context, ptr, size uint32) {
+	if w.free == nil || size == 0 || w.module.IsClosed() {
+		return
+	}
+	if _, err := w.free.Call(ctx, uint64(ptr), uint64(size)); err != nil {
+		log.Printf("[dynamic] free wasm memory of %s failed: %v", w.path, err)
+	}
+}
@@ -0,0 +1,104 @@
+package dynamic_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dynamic "github.com/aura-studio/dynamic"
+)
+
+// testWasmModule is the binary of:
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (global $heap (mut i32) (i32.const 1024))
+//	  (func (export "malloc") (param $size i32) (result i32)
+//	    global.get $heap
+//	    (global.set $heap (i32.add (global.get $heap) (local.get $size))))
+//	  (func (export "invoke") (param $mp i32) (param $ml i32) (param $pp i32) (param $pl i32) (result i64)
+//	    (if (i32.eq (i32.load8_u (local.get $mp)) (i32.const 115)) ;; 's'pin
+//	      (then (loop (br 0))))
+//	    (i64.or
+//	      (i64.shl (i64.extend_i32_u (local.get $pp)) (i64.const 32))
+//	      (i64.extend_i32_u (local.get $pl)))))
+//
+// invoke echoes the payload, or spins forever for methods starting with s.
+var testWasmModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32) -> i32, (i32 i32 i32 i32) -> i64
+	0x01, 0x0e, 0x02,
+	0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7e,
+	// functions
+	0x03, 0x03, 0x02, 0x00, 0x01,
+	// memory
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// globals
+	0x06, 0x07, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b,
+	// exports
+	0x07, 0x1c, 0x03,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x06, 'm', 'a', 'l', 'l', 'o', 'c', 0x00, 0x00,
+	0x06, 'i', 'n', 'v', 'o', 'k', 'e', 0x00, 0x01,
+	// code
+	0x0a, 0x2b, 0x02,
+	0x0b, 0x00, 0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x0b,
+	0x1d, 0x00, 0x20, 0x00, 0x2d, 0x00, 0x00, 0x41, 0xf3, 0x00, 0x46, 0x04, 0x40,
+	0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b, 0x20, 0x02, 0xad, 0x42, 0x20, 0x86,
+	0x20, 0x03, 0xad, 0x84, 0x0b,
+}
+
+func TestWasmTunnel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "echo.wasm")
+	if err := os.WriteFile(path, testWasmModule, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := dynamic.NewWasmTunnel(path)
+	if err := w.Init(context.Background()); err != nil {
+		t.Fatalf("Init err=%v", err)
+	}
+
+	out, err := w.Invoke(context.Background(), "echo", []byte("hello"))
+	if err != nil || string(out) != "hello" {
+		t.Fatalf("Invoke=%q,%v want %q,nil", out, err, "hello")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Invoke(ctx, "spin", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("spin err=%v want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("spin ignored the deadline of its ctx")
+	}
+
+	// the module stopped by the deadline is reloaded by the next call.
+	out, err = w.Invoke(context.Background(), "echo", []byte("again"))
+	if err != nil || string(out) != "again" {
+		t.Fatalf("Invoke after timeout=%q,%v want %q,nil", out, err, "again")
+	}
+
+	if err := w.Init(context.Background()); err != nil {
+		t.Fatalf("Init again err=%v", err)
+	}
+	out, err = w.Invoke(context.Background(), "echo", []byte("reinit"))
+	if err != nil || string(out) != "reinit" {
+		t.Fatalf("Invoke after Init again=%q,%v want %q,nil", out, err, "reinit")
+	}
+
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close err=%v", err)
+	}
+}